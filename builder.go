@@ -0,0 +1,201 @@
+package hedi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Usage indicators, written in ISA15.
+const (
+	UsageProduction  = "P"
+	UsageTest        = "T"
+	UsageInformation = "I"
+)
+
+// defaultVersion is the GS08 version written by an InterchangeBuilder unless set WithVersion.
+const defaultVersion = "005010"
+
+// ErrNoFunctionalGroup is returned when a transaction set is added to an InterchangeBuilder before any group.
+var ErrNoFunctionalGroup = errors.New("transaction set outside a functional group")
+
+// Party identifies a trading partner in the envelopes built by an InterchangeBuilder.
+type Party struct {
+	// Qualifier is the ISA05 or ISA07 interchange ID qualifier, "ZZ" if empty.
+	Qualifier string
+	// ID is the ISA06 or ISA08 interchange ID.
+	ID string
+	// Code is the GS02 or GS03 application code, the ID if empty.
+	Code string
+}
+
+// qualifier returns the interchange ID qualifier of the Party.
+func (p Party) qualifier() string {
+	if p.Qualifier == "" {
+		return "ZZ"
+	}
+	return p.Qualifier
+}
+
+// code returns the application code of the Party.
+func (p Party) code() string {
+	if p.Code == "" {
+		return p.ID
+	}
+	return p.Code
+}
+
+// InterchangeBuilder assembles an outbound interchange from the bodies of its transaction sets,
+// filling in the envelope headers and trailers. Its methods may be chained, and any error is
+// returned when the interchange is built.
+type InterchangeBuilder struct {
+	sender   Party
+	receiver Party
+	config   buildConfig
+	groups   []builtGroup
+	err      error
+}
+
+// builtGroup is a functional group added to an InterchangeBuilder.
+type builtGroup struct {
+	functionalID string
+	sets         []builtSet
+}
+
+// builtSet is a transaction set added to an InterchangeBuilder.
+type builtSet struct {
+	id   string
+	body Segments
+}
+
+// NewInterchange creates an InterchangeBuilder for an interchange from sender to receiver, configured by BuildOptions.
+func NewInterchange(sender, receiver Party, opts ...BuildOption) *InterchangeBuilder {
+	return &InterchangeBuilder{sender: sender, receiver: receiver, config: newBuildConfig(opts)}
+}
+
+// Group starts a functional group of the given GS01 functional identifier code, such as "PO",
+// to which following transaction sets are added.
+func (b *InterchangeBuilder) Group(functionalID string) *InterchangeBuilder {
+	b.groups = append(b.groups, builtGroup{functionalID: functionalID})
+	return b
+}
+
+// TransactionSet adds a transaction set of the given ST01 identifier code, such as "850", to the current group.
+// The body holds the segments between the ST and SE segments.
+func (b *InterchangeBuilder) TransactionSet(id string, body Segments) *InterchangeBuilder {
+	if len(b.groups) == 0 {
+		if b.err == nil {
+			b.err = fmt.Errorf("%w: %s", ErrNoFunctionalGroup, id)
+		}
+		return b
+	}
+	group := &b.groups[len(b.groups)-1]
+	group.sets = append(group.sets, builtSet{id: id, body: body})
+	return b
+}
+
+// Build returns the Interchange, with its envelope hierarchy, to be written with delimiters.
+// From version 00501, the repetition separator of DefaultDelimiters5010 is used in ISA11 if delimiters has none,
+// and the Interchange carries it in its Delimiters.
+// Control numbers are drawn from the ControlNumberSource, and the ISA and GS segments are dated
+// at the time of building, unless set WithDate. ST03 is set to the version if it names an implementation guide.
+func (b *InterchangeBuilder) Build(delimiters Delimiters) (Interchange, error) {
+	if b.err != nil {
+		return Interchange{}, b.err
+	}
+	c := b.config
+	if delimiters.Repetition == 0 && isaVersion(c.version) >= repetitionVersion {
+		delimiters.Repetition = DefaultDelimiters5010.Repetition
+	}
+	date := c.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	controlNumber, err := c.controlNumbers.Next(b.sender.ID, b.receiver.ID, InterchangeLevel)
+	if err != nil {
+		return Interchange{}, err
+	}
+	isa := ISAHeader{
+		AuthorizationQualifier:  "00",
+		SecurityQualifier:       "00",
+		SenderQualifier:         b.sender.qualifier(),
+		SenderID:                b.sender.ID,
+		ReceiverQualifier:       b.receiver.qualifier(),
+		ReceiverID:              b.receiver.ID,
+		Date:                    date,
+		StandardsID:             "U",
+		Version:                 isaVersion(c.version),
+		ControlNumber:           controlNumber,
+		AcknowledgmentRequested: c.acknowledgmentRequested,
+		UsageIndicator:          c.usageIndicator,
+	}
+	header, err := isa.Segment(delimiters)
+	if err != nil {
+		return Interchange{}, err
+	}
+	segments := Segments{header}
+
+	for _, group := range b.groups {
+		controlNumber, err := c.controlNumbers.Next(b.sender.ID, b.receiver.ID, GroupLevel)
+		if err != nil {
+			return Interchange{}, err
+		}
+		gs := GSHeader{
+			FunctionalID:      group.functionalID,
+			SenderCode:        b.sender.code(),
+			ReceiverCode:      b.receiver.code(),
+			Date:              date,
+			ControlNumber:     controlNumber,
+			ResponsibleAgency: "X",
+			Version:           c.version,
+		}
+		header, err := gs.Segment()
+		if err != nil {
+			return Interchange{}, err
+		}
+		segments = append(segments, header)
+
+		for _, set := range group.sets {
+			controlNumber, err := c.controlNumbers.Next(b.sender.ID, b.receiver.ID, TransactionSetLevel)
+			if err != nil {
+				return Interchange{}, err
+			}
+			st := Segment{ID: "ST", Elements: Elements{{Value: set.id}, {Value: fmt.Sprintf("%04d", controlNumber)}}}
+			if len(c.version) > len(defaultVersion) {
+				st.AddElement(Element{Value: c.version})
+			}
+			segments = append(segments, st)
+			segments = append(segments, set.body...)
+			segments = append(segments, Segment{ID: "SE"})
+		}
+		segments = append(segments, Segment{ID: "GE"})
+	}
+	segments = append(segments, Segment{ID: "IEA"})
+	segments.Normalize()
+
+	interchanges, err := envelopes(segments, delimiters)
+	if err != nil {
+		return Interchange{}, err
+	}
+	return interchanges[0], nil
+}
+
+// DWriteTo builds the Interchange and writes it to w with its Delimiters, as built from delimiters,
+// and WriteOptions, as for Segments.DWriteTo.
+func (b *InterchangeBuilder) DWriteTo(delimiters Delimiters, w io.Writer, opts ...WriteOption) (int64, error) {
+	interchange, err := b.Build(delimiters)
+	if err != nil {
+		return 0, err
+	}
+	return interchange.Segments.DWriteTo(interchange.Delimiters, w, opts...)
+}
+
+// isaVersion returns the ISA12 interchange control version of a GS08 version, such as "00501" for "005010X222A1".
+func isaVersion(version string) string {
+	if len(version) < len(repetitionVersion) {
+		return version
+	}
+	return version[:len(repetitionVersion)]
+}
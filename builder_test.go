@@ -0,0 +1,128 @@
+package hedi
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterchangeBuilder(t *testing.T) {
+	sender := Party{ID: "SENDER"}
+	receiver := Party{Qualifier: "01", ID: "123456789", Code: "RECEIVER"}
+	date := time.Date(2019, 4, 30, 12, 30, 0, 0, time.UTC)
+	order := Segments{
+		{ID: "BEG", Elements: Elements{{Value: "00"}, {Value: "SA"}, {Value: "PO1"}, {Omitted: true}, {Value: "20190430"}}},
+		{ID: "PO1", Elements: Elements{{Value: "1"}, {Value: "10"}, {Value: "EA"}}},
+	}
+	invoice := Segments{{ID: "BIG", Elements: Elements{{Value: "20190430"}, {Value: "INV1"}}}}
+
+	t.Run("Builds the envelopes", func(t *testing.T) {
+		builder := NewInterchange(sender, receiver, WithDate(date), WithUsageIndicator(UsageTest)).
+			Group("PO").
+			TransactionSet("850", order).
+			TransactionSet("850", order).
+			Group("IN").
+			TransactionSet("810", invoice)
+
+		buf := bytes.NewBuffer([]byte{})
+		_, err := builder.DWriteTo(DefaultDelimiters5010, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "ISA*00*          *00*          *ZZ*SENDER         *01*123456789      *190430*1230*^*00501*000000001*0*T*>~"+
+			"GS*PO*SENDER*RECEIVER*20190430*1230*1*X*005010~"+
+			"ST*850*0001~BEG*00*SA*PO1**20190430~PO1*1*10*EA~SE*4*0001~"+
+			"ST*850*0002~BEG*00*SA*PO1**20190430~PO1*1*10*EA~SE*4*0002~"+
+			"GE*2*1~"+
+			"GS*IN*SENDER*RECEIVER*20190430*1230*2*X*005010~"+
+			"ST*810*0003~BIG*20190430*INV1~SE*3*0003~"+
+			"GE*1*2~"+
+			"IEA*2*000000001~", buf.String())
+
+		segments, err := NewParser(buf).Segments()
+		assert.NoError(t, err)
+		assert.Empty(t, segments.Validate())
+	})
+
+	t.Run("Builds the envelope hierarchy", func(t *testing.T) {
+		interchange, err := NewInterchange(sender, receiver).Group("PO").TransactionSet("850", order).Build(DefaultDelimiters5010)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultDelimiters5010, interchange.Delimiters)
+		assert.Equal(t, "IEA", interchange.Trailer.ID)
+		assert.Len(t, interchange.FunctionalGroups, 1)
+		assert.Equal(t, order, interchange.FunctionalGroups[0].TransactionSets[0].Segments)
+		assert.Empty(t, interchange.Validate())
+
+		header, err := NewISAHeader(interchange.Header)
+		assert.NoError(t, err)
+		assert.Equal(t, UsageProduction, header.UsageIndicator)
+		assert.WithinDuration(t, time.Now(), header.Date, 2*time.Minute)
+	})
+
+	t.Run("Draws control numbers from the source", func(t *testing.T) {
+		source := NewMemoryControlNumbers()
+		for want := 1; want <= 2; want++ {
+			interchange, err := NewInterchange(sender, receiver, WithControlNumbers(source)).
+				Group("PO").TransactionSet("850", order).
+				Build(DefaultDelimiters5010)
+			assert.NoError(t, err)
+
+			header, _ := NewISAHeader(interchange.Header)
+			assert.Equal(t, want, header.ControlNumber)
+			assert.Equal(t, fmt.Sprintf("%09d", want), interchange.Trailer.Elements[1].Value)
+			assert.Equal(t, fmt.Sprintf("%04d", want), interchange.FunctionalGroups[0].TransactionSets[0].Header.Elements[1].Value)
+		}
+	})
+
+	t.Run("Repetition separator defaults from version 00501", func(t *testing.T) {
+		builder := NewInterchange(sender, receiver, WithDate(date)).Group("PO").TransactionSet("850", order)
+		interchange, err := builder.Build(DefaultDelimiters)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultDelimiters5010, interchange.Delimiters)
+
+		buf := bytes.NewBuffer([]byte{})
+		_, err = builder.DWriteTo(DefaultDelimiters, buf)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(buf.String(), "ISA*00*          *00*          *ZZ*SENDER         *01*123456789      *190430*1230*^*00501*"))
+
+		interchange, err = NewInterchange(sender, receiver, WithVersion("004010")).Group("PO").TransactionSet("850", order).
+			Build(DefaultDelimiters)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultDelimiters, interchange.Delimiters)
+		assert.Equal(t, "U", interchange.Header.Elements[10].Value)
+	})
+
+	t.Run("Writes earlier versions", func(t *testing.T) {
+		delimiters := Delimiters{Segment: '~', Element: '*', SubElement: ':'}
+		interchange, err := NewInterchange(sender, receiver, WithVersion("004010"), WithDate(date), WithAcknowledgmentRequested()).
+			Group("IN").TransactionSet("810", invoice).
+			Build(delimiters)
+		assert.NoError(t, err)
+		assert.Equal(t, "ISA*00*          *00*          *ZZ*SENDER         *01*123456789      *190430*1230*U*00401*000000001*1*P*:~",
+			interchange.Header.DString(delimiters))
+		assert.Equal(t, "ST*810*0001~", interchange.FunctionalGroups[0].TransactionSets[0].Header.String())
+	})
+
+	t.Run("Implementation guides are referenced in ST03", func(t *testing.T) {
+		interchange, err := NewInterchange(sender, receiver, WithVersion("005010X222A1")).
+			Group("HC").TransactionSet("837", invoice).
+			Build(DefaultDelimiters5010)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasSuffix(interchange.FunctionalGroups[0].Header.String(), "*X*005010X222A1~"))
+		assert.Equal(t, "ST*837*0001*005010X222A1~", interchange.FunctionalGroups[0].TransactionSets[0].Header.String())
+	})
+
+	t.Run("Transaction sets outside a group fail", func(t *testing.T) {
+		_, err := NewInterchange(sender, receiver).TransactionSet("850", order).Group("PO").Build(DefaultDelimiters5010)
+		assert.ErrorIs(t, err, ErrNoFunctionalGroup)
+	})
+
+	t.Run("Invalid headers fail", func(t *testing.T) {
+		_, err := NewInterchange(Party{ID: "A SENDER ID LONGER THAN FIFTEEN"}, receiver).Build(DefaultDelimiters5010)
+		assert.ErrorIs(t, err, ErrInvalidISA)
+
+		_, err = NewInterchange(sender, receiver).Group("").Build(DefaultDelimiters5010)
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+}
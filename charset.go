@@ -0,0 +1,116 @@
+package hedi
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidCharacter is returned when a value contains a character outside the configured Charset.
+	ErrInvalidCharacter = errors.New("invalid character")
+)
+
+// Charset reports whether a character is permitted within segment identifiers and element values.
+type Charset func(r rune) bool
+
+const (
+	// x12BasicSpecials holds the special characters of the X12 basic character set.
+	x12BasicSpecials = " !\"&'()*+,-./:;?="
+
+	// x12ExtendedSpecials holds the special characters added by the X12 extended character set.
+	x12ExtendedSpecials = "%@[]_{}\\|<>~#$"
+
+	// unoaSpecials holds the special characters of the EDIFACT level A character set.
+	unoaSpecials = " .,-()/='+:?!\"%&*;<>"
+)
+
+// X12Basic reports whether r is in the X12 basic character set:
+// upper case letters, digits, space and the characters !"&'()*+,-./:;?=
+func X12Basic(r rune) bool {
+	return isUpper(r) || isDigit(r) || strings.ContainsRune(x12BasicSpecials, r)
+}
+
+// X12Extended reports whether r is in the X12 extended character set:
+// the basic character set, lower case letters and the characters %@[]_{}\|<>~#$
+func X12Extended(r rune) bool {
+	return X12Basic(r) || isLower(r) || strings.ContainsRune(x12ExtendedSpecials, r)
+}
+
+// UNOA reports whether r is in the EDIFACT level A character set:
+// upper case letters, digits, space and the characters .,-()/='+:?!"%&*;<>
+func UNOA(r rune) bool {
+	return isUpper(r) || isDigit(r) || strings.ContainsRune(unoaSpecials, r)
+}
+
+// UNOB reports whether r is in the EDIFACT level B character set,
+// which permits all printable ASCII characters.
+func UNOB(r rune) bool {
+	return r >= 0x20 && r <= 0x7E
+}
+
+// UNOC reports whether r is in the EDIFACT level C character set,
+// which permits all printable characters of ISO 8859-1.
+func UNOC(r rune) bool {
+	return UNOB(r) || (r >= 0xA0 && r <= 0xFF)
+}
+
+// isUpper reports whether r is an upper case ASCII letter.
+func isUpper(r rune) bool {
+	return r >= 'A' && r <= 'Z'
+}
+
+// isLower reports whether r is a lower case ASCII letter.
+func isLower(r rune) bool {
+	return r >= 'a' && r <= 'z'
+}
+
+// isDigit reports whether r is an ASCII digit.
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// validateCharset checks the values of a segment's tokens against charset, returning a SyntaxError
+// positioned at the first offending character. The text of the segment, starting at offset, locates
+// characters in values unescaped with the release character.
+func validateCharset(tokens []RawToken, charset Charset, segment []byte, offset int64, release rune) error {
+	var segmentID []byte
+	for _, token := range tokens {
+		switch token.Type {
+		case SegmentIdentifier:
+			segmentID = token.Value
+		case ElementValue, SubElementValue, RepetitionValue:
+		default:
+			continue
+		}
+
+		if i := bytes.IndexFunc(token.Value, func(r rune) bool { return !charset(r) }); i >= 0 {
+			position := token.Position
+			if release != 0 {
+				i = escapedIndex(segment[token.Position.Offset-offset:], i, release)
+			}
+			position.Offset += int64(i)
+			return newSyntaxError(ErrInvalidCharacter, position, string(segmentID), string(token.Value))
+		}
+	}
+	return nil
+}
+
+// escapedIndex returns the index within text, escaped with the release character, of the character
+// at index i of its unescaped value.
+func escapedIndex(text []byte, i int, release rune) int {
+	j := 0
+	for n := 0; ; {
+		r, size := utf8.DecodeRune(text[j:])
+		if r == release && j+size < len(text) {
+			j += size
+			_, size = utf8.DecodeRune(text[j:])
+		}
+		if n == i {
+			return j
+		}
+		j += size
+		n += size
+	}
+}
@@ -0,0 +1,66 @@
+package hedi
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCharsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset Charset
+		valid   string
+		invalid string
+	}{
+		{name: "X12 basic", charset: X12Basic, valid: "ACME CORP 123 !\"&'()*+,-./:;?=", invalid: "a%@~é\t"},
+		{name: "X12 extended", charset: X12Extended, valid: "Acme Corp %@[]_{}\\|<>~#$", invalid: "^`é\t"},
+		{name: "UNOA", charset: UNOA, valid: "ACME CORP .,-()/='+:?!\"%&*;<>", invalid: "a@#é"},
+		{name: "UNOB", charset: UNOB, valid: "Acme Corp @#$^`~", invalid: "é\t\x7F"},
+		{name: "UNOC", charset: UNOC, valid: "Zoë Köln ©", invalid: "€\t\x85"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, r := range tt.valid {
+				assert.True(t, tt.charset(r), "%q should be valid", r)
+			}
+			for _, r := range tt.invalid {
+				assert.False(t, tt.charset(r), "%q should be invalid", r)
+			}
+		})
+	}
+}
+
+func TestLexer_Next_Charset(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+
+	t.Run("Valid input succeeds", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader(isa+"N1*ST*ACME CORP~"), WithCharset(X12Basic))
+		_, err := lexer.Tokens()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Offending character is positioned", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader(isa+"N1*ST*ACME>Corp~"), WithCharset(X12Basic))
+		_, err := lexer.Tokens()
+		assert.ErrorIs(t, err, ErrInvalidCharacter)
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, Position{Offset: 118, Segment: 2, Element: 2, Line: 1}, syntaxErr.Position)
+		assert.Equal(t, "N1", syntaxErr.SegmentID)
+		assert.Equal(t, "Corp", syntaxErr.Snippet)
+	})
+
+	t.Run("Offending character is positioned in the escaped input", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader(isa+"N1*ST*A?*b~"), WithCharset(X12Basic), WithRelease('?'))
+		_, err := lexer.Tokens()
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, Position{Offset: 115, Segment: 2, Element: 2, Line: 1}, syntaxErr.Position)
+		assert.Equal(t, "A*b", syntaxErr.Snippet)
+	})
+}
@@ -0,0 +1,202 @@
+package hedi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxControlNumber is the largest control number, of nine digits, after which numbering restarts at 1.
+const maxControlNumber = 999999999
+
+// ErrInvalidControlLevel is returned when a control number is requested for an unknown ControlLevel.
+var ErrInvalidControlLevel = errors.New("invalid control level")
+
+// ControlLevel identifies the envelope a control number is issued for.
+type ControlLevel int
+
+// Enumerated ControlLevels, each numbered independently.
+const (
+	// InterchangeLevel control numbers are written in ISA13 and IEA02.
+	InterchangeLevel ControlLevel = iota
+
+	// GroupLevel control numbers are written in GS06 and GE02.
+	GroupLevel
+
+	// TransactionSetLevel control numbers are written in ST02 and SE02.
+	TransactionSetLevel
+)
+
+// String returns the name of the ControlLevel.
+func (l ControlLevel) String() string {
+	switch l {
+	case InterchangeLevel:
+		return "interchange"
+	case GroupLevel:
+		return "group"
+	case TransactionSetLevel:
+		return "transactionSet"
+	}
+	return fmt.Sprintf("ControlLevel(%d)", int(l))
+}
+
+// valid reports whether l is one of the enumerated ControlLevels.
+func (l ControlLevel) valid() bool {
+	return l >= InterchangeLevel && l <= TransactionSetLevel
+}
+
+// ControlNumberSource issues unique, increasing control numbers for outbound envelopes,
+// numbered separately for each sender and receiver pair and ControlLevel.
+type ControlNumberSource interface {
+	Next(sender, receiver string, level ControlLevel) (int, error)
+}
+
+// nextControlNumber returns the control number following last.
+func nextControlNumber(last int) int {
+	if last >= maxControlNumber || last < 0 {
+		return 1
+	}
+	return last + 1
+}
+
+// controlKey identifies a sequence of control numbers.
+type controlKey struct {
+	sender, receiver string
+	level            ControlLevel
+}
+
+// MemoryControlNumbers is a ControlNumberSource holding its state in memory, starting from 1.
+// It is safe for concurrent use.
+type MemoryControlNumbers struct {
+	mu   sync.Mutex
+	last map[controlKey]int
+}
+
+// NewMemoryControlNumbers creates a new MemoryControlNumbers.
+func NewMemoryControlNumbers() *MemoryControlNumbers {
+	return &MemoryControlNumbers{last: map[controlKey]int{}}
+}
+
+// Next returns the next control number for the sender and receiver pair at level.
+func (m *MemoryControlNumbers) Next(sender, receiver string, level ControlLevel) (int, error) {
+	if !level.valid() {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidControlLevel, level)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := controlKey{sender: sender, receiver: receiver, level: level}
+	m.last[key] = nextControlNumber(m.last[key])
+	return m.last[key], nil
+}
+
+// FileControlNumbers is a ControlNumberSource persisting its state in a directory, in one file per sender and
+// receiver pair, so that numbering continues across restarts. It is safe for concurrent use, and on Unix
+// systems also by several processes sharing the directory, which take turns through an advisory lock.
+// Files are replaced atomically, so that a crash never leaves them partially written.
+type FileControlNumbers struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileControlNumbers creates a FileControlNumbers keeping its files in dir, which is created if need be.
+func NewFileControlNumbers(dir string) (*FileControlNumbers, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileControlNumbers{dir: dir}, nil
+}
+
+// Next returns the next control number for the sender and receiver pair at level, and records it.
+func (f *FileControlNumbers) Next(sender, receiver string, level ControlLevel) (n int, err error) {
+	if !level.valid() {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidControlLevel, level)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := filepath.Join(f.dir, controlFileName(sender, receiver))
+
+	// The lock is held on a separate file, as the state file is replaced on every update
+	lock, err := os.OpenFile(name+".lock", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if unlockErr := unlockFile(lock); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	last := map[string]int{}
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &last); err != nil {
+			return 0, fmt.Errorf("reading control numbers from %s: %w", name, err)
+		}
+	}
+
+	n = nextControlNumber(last[level.String()])
+	last[level.String()] = n
+	if data, err = json.Marshal(last); err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(name, data); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// controlFileName returns the name of the file holding the control numbers of the sender and receiver pair.
+// Characters other than ASCII letters, digits and '-' are percent-encoded, so that '_' separates the two.
+func controlFileName(sender, receiver string) string {
+	escape := func(s string) string {
+		var sb strings.Builder
+		for _, b := range []byte(s) {
+			if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' {
+				sb.WriteByte(b)
+			} else {
+				fmt.Fprintf(&sb, "%%%02X", b)
+			}
+		}
+		return sb.String()
+	}
+	return escape(sender) + "_" + escape(receiver) + ".json"
+}
+
+// writeFileAtomic writes data to a temporary file beside name, and renames it over name once synced.
+// The directory is synced after the rename, so that the rename itself survives a crash.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package hedi
+
+import (
+	"os"
+)
+
+// lockFile does nothing where advisory file locks are unavailable, leaving FileControlNumbers
+// safe for concurrent use within a single process only.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing, as for lockFile.
+func unlockFile(file *os.File) error {
+	return nil
+}
+
+// syncDir does nothing where directories cannot be synced, as on Windows, where a rename is not
+// guaranteed to survive a crash.
+func syncDir(dir string) error {
+	return nil
+}
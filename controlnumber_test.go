@@ -0,0 +1,119 @@
+package hedi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestMemoryControlNumbers(t *testing.T) {
+	source := NewMemoryControlNumbers()
+
+	for want := 1; want <= 3; want++ {
+		n, err := source.Next("SENDER", "RECEIVER", InterchangeLevel)
+		assert.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+
+	t.Run("Levels and pairs are numbered separately", func(t *testing.T) {
+		n, _ := source.Next("SENDER", "RECEIVER", GroupLevel)
+		assert.Equal(t, 1, n)
+		n, _ = source.Next("SENDER", "OTHER", InterchangeLevel)
+		assert.Equal(t, 1, n)
+		n, _ = source.Next("OTHER", "RECEIVER", InterchangeLevel)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("Numbering restarts after nine digits", func(t *testing.T) {
+		source.last[controlKey{sender: "SENDER", receiver: "RECEIVER", level: TransactionSetLevel}] = maxControlNumber
+		n, _ := source.Next("SENDER", "RECEIVER", TransactionSetLevel)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("Unknown levels fail", func(t *testing.T) {
+		_, err := source.Next("SENDER", "RECEIVER", ControlLevel(7))
+		assert.ErrorIs(t, err, ErrInvalidControlLevel)
+	})
+}
+
+func TestFileControlNumbers(t *testing.T) {
+	t.Run("Numbering continues across instances", func(t *testing.T) {
+		dir := t.TempDir()
+		source, err := NewFileControlNumbers(dir)
+		assert.NoError(t, err)
+
+		n, err := source.Next("SENDER", "RECEIVER", InterchangeLevel)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		n, _ = source.Next("SENDER", "RECEIVER", GroupLevel)
+		assert.Equal(t, 1, n)
+
+		restarted, err := NewFileControlNumbers(dir)
+		assert.NoError(t, err)
+		n, err = restarted.Next("SENDER", "RECEIVER", InterchangeLevel)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		n, _ = restarted.Next("SENDER", "OTHER", InterchangeLevel)
+		assert.Equal(t, 1, n)
+
+		data, err := os.ReadFile(filepath.Join(dir, "SENDER_RECEIVER.json"))
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"interchange": 2, "group": 1}`, string(data))
+
+		temporary, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+		assert.Empty(t, temporary)
+	})
+
+	t.Run("Concurrent use issues unique numbers", func(t *testing.T) {
+		dir := t.TempDir()
+		first, err := NewFileControlNumbers(dir)
+		assert.NoError(t, err)
+		second, err := NewFileControlNumbers(dir)
+		assert.NoError(t, err)
+
+		var mu sync.Mutex
+		var issued []int
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			source := first
+			if i%2 == 1 {
+				source = second
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 25; j++ {
+					n, err := source.Next("SENDER", "RECEIVER", TransactionSetLevel)
+					assert.NoError(t, err)
+					mu.Lock()
+					issued = append(issued, n)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		sort.Ints(issued)
+		for i, n := range issued {
+			assert.Equal(t, i+1, n)
+		}
+	})
+
+	t.Run("Identifiers are escaped in file names", func(t *testing.T) {
+		assert.Equal(t, "A%5FB_C.json", controlFileName("A_B", "C"))
+		assert.Equal(t, "A_B%5FC.json", controlFileName("A", "B_C"))
+		assert.Equal(t, "ACME%20INC_%2E%2E%2F.json", controlFileName("ACME INC", "../"))
+	})
+
+	t.Run("Corrupt files fail", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "SENDER_RECEIVER.json"), []byte("{"), 0o644))
+		source, err := NewFileControlNumbers(dir)
+		assert.NoError(t, err)
+		_, err = source.Next("SENDER", "RECEIVER", InterchangeLevel)
+		assert.Error(t, err)
+	})
+}
@@ -1,5 +1,14 @@
 package hedi
 
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNoRepetitionSeparator is returned when an element with repetitions is written
+// with Delimiters that have no Repetition separator.
+var ErrNoRepetitionSeparator = errors.New("repetitions without a repetition separator")
+
 // DefaultDelimiters defines the default Delimiters used in EDI files.
 var DefaultDelimiters = Delimiters{
 	Segment:    '~',
@@ -7,10 +16,48 @@ var DefaultDelimiters = Delimiters{
 	SubElement: '>',
 }
 
+// DefaultDelimiters5010 defines the default Delimiters used in EDI files of version 00501 and later,
+// which also declare a repetition separator in ISA11.
+var DefaultDelimiters5010 = Delimiters{
+	Segment:    '~',
+	Element:    '*',
+	SubElement: '>',
+	Repetition: '^',
+}
+
 // Delimiters contains the delimiters used for splitting segments, elements,
-// and sub-elements in EDI files.
+// sub-elements and repeated elements in EDI files.
+// A zero Repetition means the interchange does not use repetitions.
+// A zero Release means delimiters cannot be escaped within values.
 type Delimiters struct {
 	Segment    rune
 	Element    rune
 	SubElement rune
+	Repetition rune
+	Release    rune
+}
+
+// escape prefixes every delimiter or release character in value with the Release character.
+// The value is returned unchanged if no Release character is set.
+func (d Delimiters) escape(value string) string {
+	if d.Release == 0 || strings.IndexFunc(value, d.reserved) < 0 {
+		return value
+	}
+
+	var sb strings.Builder
+	for _, r := range value {
+		if d.reserved(r) {
+			sb.WriteRune(d.Release)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// reserved reports whether r is one of the delimiters and must be escaped within values.
+func (d Delimiters) reserved(r rune) bool {
+	if r == 0 {
+		return false
+	}
+	return r == d.Segment || r == d.Element || r == d.SubElement || r == d.Repetition || r == d.Release
 }
@@ -0,0 +1,22 @@
+package hedi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDelimiters_escape(t *testing.T) {
+	d := Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'}
+
+	t.Run("Value without delimiters is unchanged", func(t *testing.T) {
+		assert.Equal(t, "ACME", d.escape("ACME"))
+	})
+
+	t.Run("Delimiters and release characters are escaped", func(t *testing.T) {
+		assert.Equal(t, "1?+1=2?? ?'OK?'", d.escape("1+1=2? 'OK'"))
+	})
+
+	t.Run("Nothing is escaped without a release character", func(t *testing.T) {
+		assert.Equal(t, "A*B", DefaultDelimiters.escape("A*B"))
+	})
+}
@@ -0,0 +1,169 @@
+package hedi
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// detectionSize is the number of bytes Detect reads ahead to identify the input.
+const detectionSize = 4096
+
+// unaLength is the number of characters in an EDIFACT UNA service string advice.
+const unaLength = 9
+
+var (
+	// ErrUnknownStandard is returned when the input does not start with an X12, EDIFACT or TRADACOMS header.
+	ErrUnknownStandard = errors.New("unknown standard")
+	// ErrInvalidUNA is returned when an EDIFACT UNA service string advice is shorter than nine characters.
+	ErrInvalidUNA = errors.New("invalid UNA segment")
+)
+
+// Standard identifies an EDI standard.
+type Standard string
+
+// Enumerated Standards identified by Detect.
+const (
+	// X12 identifies ANSI ASC X12 interchanges, which start with an ISA segment.
+	X12 Standard = "X12"
+
+	// EDIFACT identifies UN/EDIFACT interchanges, which start with a UNA or UNB segment.
+	EDIFACT Standard = "EDIFACT"
+
+	// TRADACOMS identifies TRADACOMS transmissions, which start with an STX segment.
+	TRADACOMS Standard = "TRADACOMS"
+)
+
+// Format describes the standard and syntax of an input, as identified by Detect.
+type Format struct {
+	Standard Standard
+
+	// Version is the interchange control version (ISA12) for X12,
+	// and the syntax version number (UNB S001, STX STDS) for EDIFACT and TRADACOMS.
+	Version string
+
+	Delimiters Delimiters
+}
+
+// Detect peeks at the header of the input to identify its standard, version and delimiters.
+// A leading byte order mark and whitespace are ignored. It returns a reader yielding the full input,
+// including the header, which should be used in place of reader from then on.
+// X12 delimiters are read from the ISA segment, including the repetition separator from version 00501.
+// EDIFACT delimiters are read from the UNA segment, if any, or else are the defaults of the syntax level.
+// TRADACOMS segment tags are separated from the first element by '=', which is not reported.
+func Detect(reader io.Reader) (Format, io.Reader, error) {
+	buffered := bufio.NewReaderSize(reader, detectionSize)
+	head, err := buffered.Peek(detectionSize)
+	if err != nil && err != io.EOF {
+		return Format{}, buffered, err
+	}
+	err = nil
+
+	header := bytes.TrimLeft(bytes.TrimPrefix(head, []byte(byteOrderMark)), " \t\r\n")
+	skipped := head[:len(head)-len(header)]
+	base := Position{Offset: int64(len(skipped)), Line: 1 + bytes.Count(skipped, []byte{'\n'})}
+
+	var format Format
+	switch {
+	case bytes.HasPrefix(header, []byte("ISA")):
+		format, err = detectX12(header)
+	case bytes.HasPrefix(header, []byte("UNA")), bytes.HasPrefix(header, []byte("UNB")):
+		format, err = detectEDIFACT(header)
+	case bytes.HasPrefix(header, []byte("STX")):
+		format = detectTRADACOMS(header)
+	default:
+		err = newSyntaxError(ErrUnknownStandard, base, "", string(header))
+	}
+
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Err != ErrUnknownStandard {
+		syntaxErr.Position = syntaxErr.Position.from(base)
+	}
+	return format, buffered, err
+}
+
+// detectX12 identifies the version and delimiters of an X12 interchange from its ISA segment.
+func detectX12(header []byte) (Format, error) {
+	tokens, delimiters, err := lexISA(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		return Format{}, err
+	}
+	return Format{Standard: X12, Version: tokens[24].Value, Delimiters: delimiters}, nil
+}
+
+// detectEDIFACT identifies the version and delimiters of an EDIFACT interchange from its UNA and UNB segments.
+func detectEDIFACT(header []byte) (Format, error) {
+	// Level A defaults, which also apply to later levels other than B
+	delimiters := Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'}
+	advised := bytes.HasPrefix(header, []byte("UNA"))
+
+	switch {
+	case advised:
+		una := make([]rune, 0, unaLength)
+		i := 0
+		for len(una) < unaLength && i < len(header) {
+			r, size := utf8.DecodeRune(header[i:])
+			una = append(una, r)
+			i += size
+		}
+		if len(una) < unaLength {
+			return Format{}, newSyntaxError(ErrInvalidUNA, Position{Segment: 1, Line: 1}, "UNA", string(header))
+		}
+		delimiters = Delimiters{
+			Segment:    una[8],
+			Element:    una[4],
+			SubElement: una[3],
+			Repetition: una[7],
+			Release:    una[6],
+		}
+		// A space marks a character as unused
+		if delimiters.Repetition == ' ' {
+			delimiters.Repetition = 0
+		}
+		if delimiters.Release == ' ' {
+			delimiters.Release = 0
+		}
+		header = bytes.TrimLeft(header[i:], " \t\r\n")
+	case bytes.HasPrefix(header, []byte("UNB\x1d")):
+		// Level B defaults, using information separators
+		delimiters = Delimiters{Segment: '\x1c', Element: '\x1d', SubElement: '\x1f'}
+	}
+
+	format := Format{Standard: EDIFACT, Delimiters: delimiters}
+	if !bytes.HasPrefix(header, []byte("UNB")) {
+		return format, nil
+	}
+
+	// UNB+UNOA:4+...
+	unb, _, _ := cut(header, delimiters.Segment, delimiters.Release)
+	_, elements, _ := cut(unb, delimiters.Element, delimiters.Release)
+	identifier, _, _ := cut(elements, delimiters.Element, delimiters.Release)
+	_, version, _ := cut(identifier, delimiters.SubElement, delimiters.Release)
+	version, _, _ = cut(version, delimiters.SubElement, delimiters.Release)
+	format.Version = string(unescape(nil, version, delimiters.Release))
+
+	// From syntax version 4, the repetition separator defaults to '*', or to a further information separator at level B
+	if !advised && format.Version >= "4" {
+		format.Delimiters.Repetition = '*'
+		if delimiters.Element == '\x1d' {
+			format.Delimiters.Repetition = '\x19'
+		}
+	}
+	return format, nil
+}
+
+// detectTRADACOMS identifies the version and delimiters of a TRADACOMS transmission from its STX segment.
+func detectTRADACOMS(header []byte) Format {
+	delimiters := Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'}
+
+	// STX=ANA:1+...
+	stx, _, _ := cut(header, delimiters.Segment, delimiters.Release)
+	_, elements, _ := cut(stx, '=', delimiters.Release)
+	standard, _, _ := cut(elements, delimiters.Element, delimiters.Release)
+	_, version, _ := cut(standard, delimiters.SubElement, delimiters.Release)
+	version, _, _ = cut(version, delimiters.SubElement, delimiters.Release)
+
+	return Format{Standard: TRADACOMS, Version: string(unescape(nil, version, delimiters.Release)), Delimiters: delimiters}
+}
@@ -0,0 +1,159 @@
+package hedi
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Format
+	}{
+		{
+			name:  "X12 before version 00501",
+			input: "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000001*0*T*>~GS*PO~",
+			want: Format{
+				Standard:   X12,
+				Version:    "00401",
+				Delimiters: Delimiters{Segment: '~', Element: '*', SubElement: '>'},
+			},
+		},
+		{
+			name:  "X12 with repetition separator",
+			input: "ISA|00|          |00|          |ZZ|SENDER         |ZZ|RECEIVER       |190430|1230|^|00501|000000001|0|T|:\nGS|HC\n",
+			want: Format{
+				Standard:   X12,
+				Version:    "00501",
+				Delimiters: Delimiters{Segment: '\n', Element: '|', SubElement: ':', Repetition: '^'},
+			},
+		},
+		{
+			name:  "X12 after a byte order mark and whitespace",
+			input: byteOrderMark + "\r\n ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000001*0*T*>~",
+			want: Format{
+				Standard:   X12,
+				Version:    "00401",
+				Delimiters: Delimiters{Segment: '~', Element: '*', SubElement: '>'},
+			},
+		},
+		{
+			name:  "EDIFACT with service string advice",
+			input: "UNA:+.? 'UNB+UNOC:3+SENDER+RECEIVER+190430:1230+1'",
+			want: Format{
+				Standard:   EDIFACT,
+				Version:    "3",
+				Delimiters: Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'},
+			},
+		},
+		{
+			name:  "EDIFACT with custom service string advice",
+			input: "UNA|*,#^!\nUNB*UNOC|4*SENDER*RECEIVER*190430|1230*1!",
+			want: Format{
+				Standard:   EDIFACT,
+				Version:    "4",
+				Delimiters: Delimiters{Segment: '!', Element: '*', SubElement: '|', Repetition: '^', Release: '#'},
+			},
+		},
+		{
+			name:  "EDIFACT version 3 without service string advice",
+			input: "UNB+UNOA:3+SENDER+RECEIVER+190430:1230+1'",
+			want: Format{
+				Standard:   EDIFACT,
+				Version:    "3",
+				Delimiters: Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'},
+			},
+		},
+		{
+			name:  "EDIFACT version 4 without service string advice",
+			input: "UNB+UNOA:4+SENDER+RECEIVER+20190430:1230+1'",
+			want: Format{
+				Standard:   EDIFACT,
+				Version:    "4",
+				Delimiters: Delimiters{Segment: '\'', Element: '+', SubElement: ':', Repetition: '*', Release: '?'},
+			},
+		},
+		{
+			name:  "EDIFACT level B without service string advice",
+			input: "UNB\x1dUNOB\x1f3\x1dSENDER\x1dRECEIVER\x1d190430\x1f1230\x1d1\x1c",
+			want: Format{
+				Standard:   EDIFACT,
+				Version:    "3",
+				Delimiters: Delimiters{Segment: '\x1c', Element: '\x1d', SubElement: '\x1f'},
+			},
+		},
+		{
+			name:  "TRADACOMS",
+			input: "STX=ANA:1+5000000000000:SENDER+5010000000000:RECEIVER+190430:123000+1'MHD=1+ORDHDR:9'",
+			want: Format{
+				Standard:   TRADACOMS,
+				Version:    "1",
+				Delimiters: Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, reader, err := Detect(iotest.HalfReader(strings.NewReader(tt.input)))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, format)
+
+			data, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.input, string(data))
+		})
+	}
+
+	t.Run("Detected input can be parsed", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		format, reader, err := Detect(file)
+		assert.NoError(t, err)
+		assert.Equal(t, X12, format.Standard)
+
+		segments, err := NewParser(reader).Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 37)
+	})
+
+	t.Run("Unknown standard should fail", func(t *testing.T) {
+		_, reader, err := Detect(strings.NewReader("\nHDR*1*2~"))
+		assert.ErrorIs(t, err, ErrUnknownStandard)
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, Position{Offset: 1, Line: 2}, syntaxErr.Position)
+
+		data, _ := io.ReadAll(reader)
+		assert.Equal(t, "\nHDR*1*2~", string(data))
+	})
+
+	t.Run("Truncated ISA should fail", func(t *testing.T) {
+		_, _, err := Detect(strings.NewReader("  ISA*00*    "))
+		assert.ErrorIs(t, err, ErrInvalidISALength)
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, int64(2), syntaxErr.Position.Offset)
+	})
+
+	t.Run("Truncated UNA should fail", func(t *testing.T) {
+		_, _, err := Detect(strings.NewReader("UNA:+."))
+		assert.ErrorIs(t, err, ErrInvalidUNA)
+	})
+
+	t.Run("Reader errors should fail", func(t *testing.T) {
+		errRead := errors.New("connection reset")
+		_, _, err := Detect(iotest.ErrReader(errRead))
+		assert.ErrorIs(t, err, errRead)
+	})
+}
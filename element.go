@@ -5,31 +5,76 @@ import (
 )
 
 // Element represents an individual EDI element, containing a value and optional sub-elements.
+// Any further occurrences of a repeated element are held in Repetitions.
+// Omitted marks an element that is not present, as distinct from one that is present with an empty value;
+// both are written as an empty value.
 type Element struct {
 	Value       string
 	SubElements []string
+	Repetitions Elements
+	Omitted     bool
 }
 
 // String returns the default delimited string representation of the Element.
-// It uses the DefaultDelimiters for formatting.
+// It uses the DefaultDelimiters5010 for formatting, so that any repetitions are separated.
 func (e Element) String() string {
-	return e.DString(DefaultDelimiters)
+	return e.DString(DefaultDelimiters5010)
 }
 
 // DString returns a delimited string representation of the Element.
-// It formats the Element's value and sub-elements using the provided Delimiters.
+// It formats the Element's value, sub-elements and repetitions using the provided Delimiters,
+// escaping any delimiters within them if a Release character is set.
+// It panics with ErrNoRepetitionSeparator if the Element has Repetitions and the Delimiters have
+// no Repetition separator, as they cannot be told apart; Segments.DWriteTo returns the error instead.
 func (e Element) DString(delimiters Delimiters) string {
+	if len(e.Repetitions) > 0 && delimiters.Repetition == 0 {
+		panic(ErrNoRepetitionSeparator)
+	}
 	var sb strings.Builder
 
-	sb.WriteString(e.Value)
+	sb.WriteString(delimiters.escape(e.Value))
 	for _, subElement := range e.SubElements {
 		sb.WriteRune(delimiters.SubElement)
-		sb.WriteString(subElement)
+		sb.WriteString(delimiters.escape(subElement))
+	}
+	for _, repetition := range e.Repetitions {
+		sb.WriteRune(delimiters.Repetition)
+		sb.WriteString(repetition.DString(delimiters))
 	}
 
 	return sb.String()
 }
 
+// Empty reports whether the Element has no value, no sub-element values and no non-empty repetitions,
+// whether or not it is Omitted.
+func (e Element) Empty() bool {
+	if e.Value != "" {
+		return false
+	}
+	for _, subElement := range e.SubElements {
+		if subElement != "" {
+			return false
+		}
+	}
+	for _, repetition := range e.Repetitions {
+		if !repetition.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// trimTrailing returns the Element without trailing empty sub-elements and repetitions.
+func (e Element) trimTrailing() Element {
+	n := len(e.SubElements)
+	for n > 0 && e.SubElements[n-1] == "" {
+		n--
+	}
+	e.SubElements = e.SubElements[:n]
+	e.Repetitions = e.Repetitions.trimTrailing()
+	return e
+}
+
 // AddSubElement appends a sub-element value to the Element's SubElements slice.
 // Initializes SubElements if it is nil.
 func (e *Element) AddSubElement(value string) {
@@ -39,9 +84,38 @@ func (e *Element) AddSubElement(value string) {
 	e.SubElements = append(e.SubElements, value)
 }
 
+// AddRepetition appends a repeated occurrence of the Element with the given value.
+func (e *Element) AddRepetition(value string) {
+	e.Repetitions = append(e.Repetitions, Element{Value: value})
+}
+
 // Elements is a slice of Element structs, often representing a list of elements in an EDI segment.
 type Elements []Element
 
+// trimTrailing returns a copy of the Elements without trailing empty elements,
+// each trimmed of its trailing empty sub-elements and repetitions.
+func (ee Elements) trimTrailing() Elements {
+	trimmed := make(Elements, len(ee))
+	for i, e := range ee {
+		trimmed[i] = e.trimTrailing()
+	}
+	n := len(trimmed)
+	for n > 0 && trimmed[n-1].Empty() {
+		n--
+	}
+	return trimmed[:n]
+}
+
+// omit marks the Elements, and their repetitions, that are Empty as Omitted.
+func (ee Elements) omit() {
+	for i := range ee {
+		ee[i].Repetitions.omit()
+		if ee[i].Empty() {
+			ee[i].Omitted = true
+		}
+	}
+}
+
 // Last returns the last Element in the Elements slice.
 // Returns nil and false if the Elements slice is empty.
 func (ee Elements) Last() (*Element, bool) {
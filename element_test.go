@@ -17,6 +17,12 @@ func TestElement_String(t *testing.T) {
 	})
 }
 
+func TestElement_String_Repetitions(t *testing.T) {
+	e := &Element{Value: "ABK", SubElements: []string{"I10"}, Repetitions: Elements{{Value: "ABF", SubElements: []string{"I11"}}}}
+	assert.Equal(t, "ABK>I10^ABF>I11", e.String())
+	assert.PanicsWithValue(t, ErrNoRepetitionSeparator, func() { _ = e.DString(DefaultDelimiters) })
+}
+
 func TestElement_DString(t *testing.T) {
 	t.Run("Element with no sub-elements returns value", func(t *testing.T) {
 		e := &Element{Value: "00"}
@@ -37,6 +43,20 @@ func TestElement_AddSubElement(t *testing.T) {
 	assert.Equal(t, []string{"1200"}, e.SubElements)
 }
 
+func TestElement_AddRepetition(t *testing.T) {
+	e := &Element{Value: "ABK"}
+	e.AddRepetition("ABF")
+	assert.Equal(t, Elements{{Value: "ABF"}}, e.Repetitions)
+}
+
+func TestElement_Empty(t *testing.T) {
+	assert.True(t, Element{}.Empty())
+	assert.True(t, Element{Omitted: true}.Empty())
+	assert.True(t, Element{SubElements: []string{"", ""}, Repetitions: Elements{{}}}.Empty())
+	assert.False(t, Element{SubElements: []string{"", "1"}}.Empty())
+	assert.False(t, Element{Repetitions: Elements{{Value: "ABF"}}}.Empty())
+}
+
 func TestElements_Last(t *testing.T) {
 	// Creating some mock 850-specific elements
 	elem1 := Element{Value: "PO1", SubElements: []string{"001"}}
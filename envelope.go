@@ -0,0 +1,211 @@
+package hedi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+)
+
+var (
+	// ErrMissingTrailer is returned when an ISA, GS or ST header is not closed by its IEA, GE or SE trailer.
+	ErrMissingTrailer = errors.New("missing trailer")
+	// ErrUnexpectedTrailer is returned when an IEA, GE or SE trailer does not close an open header.
+	ErrUnexpectedTrailer = errors.New("unexpected trailer")
+	// ErrUnexpectedSegment is returned when a segment appears outside the envelope it belongs in,
+	// such as a GS segment outside an interchange or a body segment outside a transaction set.
+	ErrUnexpectedSegment = errors.New("unexpected segment")
+)
+
+// FunctionalGroup represents a GS/GE enveloped group of transaction sets within an Interchange.
+type FunctionalGroup struct {
+	Header          Segment
+	TransactionSets []TransactionSet
+	// Trailer is the GE segment, or nil if it is missing.
+	Trailer *Segment
+}
+
+// TransactionSet represents an ST/SE enveloped transaction set within a FunctionalGroup.
+type TransactionSet struct {
+	Header Segment
+	// Segments are the body of the transaction set, between its header and trailer.
+	Segments Segments
+	// Trailer is the SE segment, or nil if it is missing.
+	Trailer *Segment
+}
+
+// Envelopes reads from the underlying reader and builds the envelope hierarchy of each interchange,
+// delegating to EnvelopesContext.
+func (p *Parser) Envelopes() ([]Interchange, error) {
+	return p.EnvelopesContext(context.Background())
+}
+
+// EnvelopesContext reads from the underlying reader and builds the envelope hierarchy of each interchange:
+// its FunctionalGroups and their TransactionSets, checking periodically whether ctx is done.
+// A syntax error ends parsing, as for SegmentsContext. Headers without their trailers, trailers without
+// their headers and segments outside the envelope they belong in do not; the best-effort Interchanges are
+// returned along with an ErrorList of all such problems, and those recorded in recovery mode, in input order.
+func (p *Parser) EnvelopesContext(ctx context.Context) ([]Interchange, error) {
+	builder := &envelopeBuilder{}
+	for i := 0; ; i++ {
+		if err := p.lexer.checkContext(ctx, i); err != nil {
+			return nil, err
+		}
+		segment, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && p.lexer.config.recovery {
+			break // Recorded in the ErrorList
+		}
+		if err != nil {
+			return nil, err
+		}
+		builder.add(segment, p.lexer.Delimiters())
+	}
+	return builder.result(p.errors)
+}
+
+// envelopeBuilder assembles Interchanges from a stream of segments, recording structural problems as it goes.
+type envelopeBuilder struct {
+	interchanges []Interchange
+	errors       ErrorList
+
+	interchange *Interchange
+	group       *FunctionalGroup
+	set         *TransactionSet
+	// start is the index in interchange.Segments of the header of the open transaction set.
+	start int
+}
+
+// add places segment within the envelope hierarchy. Segments that do not fit are recorded as errors and,
+// outside an interchange, dropped.
+func (b *envelopeBuilder) add(segment Segment, delimiters Delimiters) {
+	switch segment.ID {
+	case "ISA":
+		b.closeInterchange(nil)
+		b.interchange = &Interchange{Delimiters: delimiters, Header: segment}
+	case "GS":
+		if b.interchange == nil {
+			b.report(ErrUnexpectedSegment, segment)
+			return
+		}
+		b.closeGroup(nil)
+		b.group = &FunctionalGroup{Header: segment}
+	case "ST":
+		if b.group == nil {
+			b.report(ErrUnexpectedSegment, segment)
+			b.append(segment)
+			return
+		}
+		b.closeSet(nil)
+		b.set = &TransactionSet{Header: segment}
+		b.start = len(b.interchange.Segments)
+	case "SE":
+		if b.set == nil {
+			b.report(ErrUnexpectedTrailer, segment)
+			b.append(segment)
+			return
+		}
+		b.append(segment)
+		b.closeSet(&segment)
+		return
+	case "GE":
+		if b.group == nil {
+			b.report(ErrUnexpectedTrailer, segment)
+			b.append(segment)
+			return
+		}
+		b.closeSet(nil)
+		b.append(segment)
+		b.closeGroup(&segment)
+		return
+	case "IEA":
+		if b.interchange == nil {
+			b.report(ErrUnexpectedTrailer, segment)
+			return
+		}
+		b.closeGroup(nil)
+		b.append(segment)
+		b.closeInterchange(&segment)
+		return
+	default:
+		// TA1 interchange acknowledgments precede any functional groups
+		if b.set == nil && !(segment.ID == "TA1" && b.interchange != nil && b.group == nil) {
+			b.report(ErrUnexpectedSegment, segment)
+		}
+	}
+	b.append(segment)
+}
+
+// append adds segment to the open interchange, if any.
+func (b *envelopeBuilder) append(segment Segment) {
+	if b.interchange != nil {
+		b.interchange.Segments = append(b.interchange.Segments, segment)
+	}
+}
+
+// closeSet closes the open transaction set, if any, with trailer, or reports its trailer as missing if nil.
+// A trailer must already have been appended, and any nested envelopes closed.
+func (b *envelopeBuilder) closeSet(trailer *Segment) {
+	if b.set == nil {
+		return
+	}
+	end := len(b.interchange.Segments)
+	if trailer != nil {
+		end--
+	} else {
+		b.report(ErrMissingTrailer, b.set.Header)
+	}
+	b.set.Segments = b.interchange.Segments[b.start+1 : end : end]
+	b.set.Trailer = trailer
+	b.group.TransactionSets = append(b.group.TransactionSets, *b.set)
+	b.set = nil
+}
+
+// closeGroup closes the open functional group, if any, and its transaction set, as for closeSet.
+func (b *envelopeBuilder) closeGroup(trailer *Segment) {
+	if b.group == nil {
+		return
+	}
+	b.closeSet(nil)
+	if trailer == nil {
+		b.report(ErrMissingTrailer, b.group.Header)
+	}
+	b.group.Trailer = trailer
+	b.interchange.FunctionalGroups = append(b.interchange.FunctionalGroups, *b.group)
+	b.group = nil
+}
+
+// closeInterchange closes the open interchange, if any, and its functional group, as for closeSet.
+func (b *envelopeBuilder) closeInterchange(trailer *Segment) {
+	if b.interchange == nil {
+		return
+	}
+	b.closeGroup(nil)
+	if trailer == nil {
+		b.report(ErrMissingTrailer, b.interchange.Header)
+	}
+	b.interchange.Trailer = trailer
+	b.interchanges = append(b.interchanges, *b.interchange)
+	b.interchange = nil
+}
+
+// report records err for segment.
+func (b *envelopeBuilder) report(err error, segment Segment) {
+	b.errors = append(b.errors, newSyntaxError(err, segment.Position, segment.ID, ""))
+}
+
+// result closes any open envelopes and returns the Interchanges built, along with the problems found,
+// including parseErrors, in order of position.
+func (b *envelopeBuilder) result(parseErrors ErrorList) ([]Interchange, error) {
+	b.closeInterchange(nil)
+	errs := append(append(ErrorList(nil), parseErrors...), b.errors...)
+	if len(errs) == 0 {
+		return b.interchanges, nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Position.Segment < errs[j].Position.Segment
+	})
+	return b.interchanges, errs
+}
@@ -0,0 +1,149 @@
+package hedi
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+// envelopeErrors returns the underlying error and segment identifier of each SyntaxError in err.
+func envelopeErrors(t *testing.T, err error) [][2]string {
+	var list ErrorList
+	if !assert.True(t, errors.As(err, &list)) {
+		return nil
+	}
+	var found [][2]string
+	for _, syntaxErr := range list {
+		found = append(found, [2]string{syntaxErr.Err.Error(), syntaxErr.SegmentID})
+	}
+	return found
+}
+
+func TestParser_Envelopes(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000001*0*T*>~"
+
+	t.Run("Builds the envelope hierarchy", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		interchanges, err := NewParser(file).Envelopes()
+		assert.NoError(t, err)
+		assert.Len(t, interchanges, 2)
+
+		first := interchanges[0]
+		assert.Equal(t, "ISA", first.Header.ID)
+		assert.Equal(t, "IEA", first.Trailer.ID)
+		assert.Equal(t, '*', first.Delimiters.Element)
+		assert.Len(t, first.Segments, 7)
+		assert.Len(t, first.FunctionalGroups, 1)
+
+		group := first.FunctionalGroups[0]
+		assert.Equal(t, "PO", group.Header.Elements[0].Value)
+		assert.Equal(t, "GE", group.Trailer.ID)
+		assert.Len(t, group.TransactionSets, 1)
+
+		set := group.TransactionSets[0]
+		assert.Equal(t, "850", set.Header.Elements[0].Value)
+		assert.Equal(t, "SE", set.Trailer.ID)
+		assert.Len(t, set.Segments, 1)
+		assert.Equal(t, "BEG", set.Segments[0].ID)
+
+		second := interchanges[1]
+		assert.Equal(t, '|', second.Delimiters.Element)
+		assert.Equal(t, "810", second.FunctionalGroups[0].TransactionSets[0].Header.Elements[0].Value)
+	})
+
+	t.Run("Groups several transaction sets", func(t *testing.T) {
+		input := isa + "GS*PO~ST*850*0001~BEG*00~SE*3*0001~ST*850*0002~BEG*00~REF*ZZ~SE*4*0002~GE*2*1~" +
+			"GS*IN~ST*810*0003~BIG*20190430~SE*3*0003~GE*1*2~IEA*2*000000001~"
+		interchanges, err := NewParser(strings.NewReader(input)).Envelopes()
+		assert.NoError(t, err)
+		assert.Len(t, interchanges, 1)
+
+		groups := interchanges[0].FunctionalGroups
+		assert.Len(t, groups, 2)
+		assert.Len(t, groups[0].TransactionSets, 2)
+		assert.Len(t, groups[0].TransactionSets[1].Segments, 2)
+		assert.Len(t, groups[1].TransactionSets, 1)
+		assert.Len(t, interchanges[0].Segments, 16)
+	})
+
+	t.Run("Interchange acknowledgments precede groups", func(t *testing.T) {
+		input := isa + "TA1*000000001*190430*1230*A*000~IEA*0*000000001~"
+		interchanges, err := NewParser(strings.NewReader(input)).Envelopes()
+		assert.NoError(t, err)
+		assert.Len(t, interchanges[0].Segments, 3)
+		assert.Empty(t, interchanges[0].FunctionalGroups)
+	})
+
+	t.Run("Missing trailers are reported", func(t *testing.T) {
+		input := isa + "GS*PO~ST*850*0001~BEG*00~GE*1*1~GS*IN~ST*810*0002~BIG*20190430~"
+		interchanges, err := NewParser(strings.NewReader(input)).Envelopes()
+		assert.Equal(t, [][2]string{
+			{"missing trailer", "ISA"},
+			{"missing trailer", "ST"},
+			{"missing trailer", "GS"},
+			{"missing trailer", "ST"},
+		}, envelopeErrors(t, err))
+
+		assert.Len(t, interchanges, 1)
+		assert.Nil(t, interchanges[0].Trailer)
+		groups := interchanges[0].FunctionalGroups
+		assert.Len(t, groups, 2)
+		assert.Equal(t, "GE", groups[0].Trailer.ID)
+		assert.Nil(t, groups[0].TransactionSets[0].Trailer)
+		assert.Len(t, groups[0].TransactionSets[0].Segments, 1)
+		assert.Equal(t, "BEG", groups[0].TransactionSets[0].Segments[0].ID)
+		assert.Nil(t, groups[1].Trailer)
+		assert.Equal(t, "BIG", groups[1].TransactionSets[0].Segments[0].ID)
+	})
+
+	t.Run("Unexpected trailers and segments are reported", func(t *testing.T) {
+		input := "GS*PO~" + isa + "ST*850*0001~GS*PO~BEG*00~SE*2*0001~GE*0*1~GE*0*1~IEA*1*000000001~IEA*1*000000001~"
+		interchanges, err := NewParser(strings.NewReader(input), WithDelimiters(DefaultDelimiters)).Envelopes()
+
+		var list ErrorList
+		assert.True(t, errors.As(err, &list))
+		assert.Equal(t, [][2]string{
+			{"unexpected segment", "GS"},
+			{"unexpected segment", "ST"},
+			{"unexpected segment", "BEG"},
+			{"unexpected trailer", "SE"},
+			{"unexpected trailer", "GE"},
+			{"unexpected trailer", "IEA"},
+		}, envelopeErrors(t, err))
+		assert.Equal(t, 1, list[0].Position.Segment)
+		assert.Equal(t, 10, list[5].Position.Segment)
+
+		assert.Len(t, interchanges, 1)
+		assert.Len(t, interchanges[0].Segments, 8)
+		assert.Len(t, interchanges[0].FunctionalGroups, 1)
+		assert.Empty(t, interchanges[0].FunctionalGroups[0].TransactionSets)
+	})
+
+	t.Run("Syntax errors end parsing", func(t *testing.T) {
+		interchanges, err := NewParser(strings.NewReader(isa+"GS*PO~N1*ST*A*B~"), WithMaxElements(2)).Envelopes()
+		assert.ErrorIs(t, err, ErrTooManyElements)
+		assert.Nil(t, interchanges)
+	})
+
+	t.Run("Syntax errors are recorded in recovery mode", func(t *testing.T) {
+		input := isa + "GS*PO~ST*850*0001~n1*bad~SE*2*0001~GE*1*1~IEA*1*000000001~"
+		interchanges, err := NewParser(strings.NewReader(input), WithRecovery()).Envelopes()
+		assert.Equal(t, [][2]string{{"invalid segment identifier", "n1"}}, envelopeErrors(t, err))
+		assert.Len(t, interchanges, 1)
+		assert.Empty(t, interchanges[0].FunctionalGroups[0].TransactionSets[0].Segments)
+	})
+
+	t.Run("Canceled context stops parsing", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := NewParser(strings.NewReader(isa)).EnvelopesContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
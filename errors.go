@@ -0,0 +1,85 @@
+package hedi
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSnippetLength is the maximum number of bytes of input quoted by a SyntaxError.
+const maxSnippetLength = 40
+
+// SyntaxError describes a failure to lex or parse the input, and where in the input it occurred.
+// The underlying error, typically one of the package's sentinel errors, is available through errors.Is and errors.As.
+type SyntaxError struct {
+	Err       error
+	Position  Position
+	SegmentID string
+	Snippet   string
+}
+
+// newSyntaxError returns a SyntaxError wrapping err, quoting at most maxSnippetLength bytes of input.
+func newSyntaxError(err error, position Position, segmentID string, input string) *SyntaxError {
+	return &SyntaxError{
+		Err:       err,
+		Position:  position,
+		SegmentID: segmentID,
+		Snippet:   snippet(input),
+	}
+}
+
+// Error returns a description of the error including its position and snippet.
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("%v at offset %d (segment %d %q, element %d, line %d)",
+		e.Err, e.Position.Offset, e.Position.Segment, e.SegmentID, e.Position.Element, e.Position.Line)
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(": %q", e.Snippet)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// snippet truncates input to at most maxSnippetLength bytes without splitting a UTF-8 sequence.
+func snippet(input string) string {
+	if len(input) <= maxSnippetLength {
+		return input
+	}
+	end := maxSnippetLength
+	for end > 0 && !utf8.RuneStart(input[end]) {
+		end--
+	}
+	return input[:end]
+}
+
+// ErrorList is a list of SyntaxErrors collected while parsing in recovery mode.
+type ErrorList []*SyntaxError
+
+// Error returns the number of errors and their descriptions.
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(l), strings.Join(messages, "; "))
+}
+
+// ContextError is returned when lexing or parsing is stopped by the cancellation of a context.
+// The context's error, context.Canceled or context.DeadlineExceeded, is available through errors.Is.
+type ContextError struct {
+	Err      error
+	Position Position
+}
+
+// Error returns a description of the error including the position reached.
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("%v at offset %d (segment %d, line %d)", e.Err, e.Position.Offset, e.Position.Segment, e.Position.Line)
+}
+
+// Unwrap returns the context's error.
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
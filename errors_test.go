@@ -0,0 +1,50 @@
+package hedi
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxError_Error(t *testing.T) {
+	t.Run("Includes position and snippet", func(t *testing.T) {
+		err := newSyntaxError(ErrElementExpected, Position{Offset: 120, Segment: 3, Element: 2, Line: 1}, "PO1", "PO1*1*EA")
+		assert.Equal(t, `element expected at offset 120 (segment 3 "PO1", element 2, line 1): "PO1*1*EA"`, err.Error())
+	})
+
+	t.Run("Omits empty snippet", func(t *testing.T) {
+		err := newSyntaxError(ErrInvalidISALength, Position{Segment: 1, Line: 1}, "ISA", "")
+		assert.Equal(t, `invalid ISA length at offset 0 (segment 1 "ISA", element 0, line 1)`, err.Error())
+	})
+}
+
+func TestSyntaxError_Unwrap(t *testing.T) {
+	var err error = newSyntaxError(ErrInvalidISALength, Position{}, "ISA", "")
+	assert.ErrorIs(t, err, ErrInvalidISALength)
+
+	var syntaxErr *SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+	assert.Equal(t, "ISA", syntaxErr.SegmentID)
+}
+
+func TestSnippet(t *testing.T) {
+	assert.Equal(t, "ISA*00", snippet("ISA*00"))
+	assert.Len(t, snippet(strings.Repeat("A", 100)), maxSnippetLength)
+	assert.Equal(t, strings.Repeat("A", 39), snippet(strings.Repeat("A", 39)+"é"+"B"))
+}
+
+func TestErrorList_Error(t *testing.T) {
+	list := ErrorList{
+		newSyntaxError(ErrEmptySegment, Position{Offset: 10, Segment: 2, Line: 1}, "", ""),
+		newSyntaxError(ErrInvalidSegmentID, Position{Offset: 11, Segment: 3, Line: 1}, "n1", "n1"),
+	}
+	assert.Equal(t, `2 errors: empty segment at offset 10 (segment 2 "", element 0, line 1); invalid segment identifier at offset 11 (segment 3 "n1", element 0, line 1): "n1"`, list.Error())
+}
+
+func TestContextError_Error(t *testing.T) {
+	err := &ContextError{Err: context.Canceled, Position: Position{Offset: 196, Segment: 10, Line: 1}}
+	assert.Equal(t, "context canceled at offset 196 (segment 10, line 1)", err.Error())
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,110 @@
+package hedi
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// gsDateLayout and gsTimeLayout are the layouts of the GS04 group date and GS05 group time.
+const (
+	gsDateLayout = "20060102"
+	gsTimeLayout = "1504"
+)
+
+// gsMaxControlNumber is the largest GS06 group control number, of at most nine digits.
+const gsMaxControlNumber = 999999999
+
+// gsFieldWidths holds the minimum and maximum widths of the GS01 to GS08 elements.
+var gsFieldWidths = [8][2]int{{2, 2}, {2, 15}, {2, 15}, {8, 8}, {4, 8}, {1, 9}, {1, 2}, {1, 12}}
+
+// GSHeader is the typed form of a GS functional group header.
+type GSHeader struct {
+	// FunctionalID is the GS01 functional identifier code, such as "PO" for purchase orders.
+	FunctionalID string
+	SenderCode   string // GS02
+	ReceiverCode string // GS03
+	// Date is the group date and time, GS04 and GS05, to the second.
+	Date          time.Time
+	ControlNumber int // GS06
+	// ResponsibleAgency is the GS07 responsible agency code, "X" for X12.
+	ResponsibleAgency string
+	// Version is the GS08 version, release and industry identifier code, such as "004010".
+	Version string
+}
+
+// NewGSHeader converts a GS segment to a GSHeader.
+// It returns a *SyntaxError wrapping ErrInvalidHeader if the segment is not a complete GS segment,
+// or its date, time or control number are not numeric.
+func NewGSHeader(segment Segment) (GSHeader, error) {
+	if segment.ID != "GS" || len(segment.Elements) < len(gsFieldWidths) {
+		return GSHeader{}, newSyntaxError(ErrInvalidHeader, segment.Position, segment.ID, "")
+	}
+	value := func(i int) string {
+		return segment.Elements[i-1].Value
+	}
+	invalid := func(i int) error {
+		position := segment.Position
+		position.Element = i
+		return newSyntaxError(ErrInvalidHeader, position, segment.ID, value(i))
+	}
+
+	header := GSHeader{
+		FunctionalID:      value(1),
+		SenderCode:        value(2),
+		ReceiverCode:      value(3),
+		ResponsibleAgency: value(7),
+		Version:           value(8),
+	}
+
+	// GS05 may include seconds and decimal seconds, which are ignored
+	clock := value(5)
+	layout := gsTimeLayout
+	if len(clock) >= 6 {
+		clock, layout = clock[:6], gsTimeLayout+"05"
+	}
+	date, err := time.Parse(gsDateLayout+layout, value(4)+clock)
+	if err != nil {
+		return GSHeader{}, invalid(4)
+	}
+	header.Date = date
+	if header.ControlNumber, err = strconv.Atoi(value(6)); err != nil {
+		return GSHeader{}, invalid(6)
+	}
+	return header, nil
+}
+
+// Segment converts the GSHeader to a GS segment. GS05 includes seconds only if they are not zero.
+// It returns an error wrapping ErrInvalidHeader if a field is too short or too long, or the control number
+// does not fit nine digits.
+func (h GSHeader) Segment() (Segment, error) {
+	if h.ControlNumber < 0 || h.ControlNumber > gsMaxControlNumber {
+		return Segment{}, fmt.Errorf("%w: GS06 %d is not a nine digit number", ErrInvalidHeader, h.ControlNumber)
+	}
+	layout := gsTimeLayout
+	if h.Date.Second() != 0 {
+		layout += "05"
+	}
+
+	values := [len(gsFieldWidths)]string{
+		h.FunctionalID,
+		h.SenderCode,
+		h.ReceiverCode,
+		h.Date.Format(gsDateLayout),
+		h.Date.Format(layout),
+		strconv.Itoa(h.ControlNumber),
+		h.ResponsibleAgency,
+		h.Version,
+	}
+
+	segment := NewSegment("GS")
+	for i, value := range values {
+		width := gsFieldWidths[i]
+		if n := utf8.RuneCountInString(value); n < width[0] || n > width[1] {
+			return Segment{}, fmt.Errorf("%w: GS%02d %q is not %d to %d characters", ErrInvalidHeader, i+1, value, width[0], width[1])
+		}
+		segment.AddElement(Element{Value: value})
+	}
+	return *segment, nil
+}
@@ -0,0 +1,76 @@
+package hedi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGSHeader(t *testing.T) {
+	want := GSHeader{
+		FunctionalID:      "PO",
+		SenderCode:        "SENDER",
+		ReceiverCode:      "RECEIVER",
+		Date:              time.Date(2019, 4, 30, 12, 30, 0, 0, time.UTC),
+		ControlNumber:     1,
+		ResponsibleAgency: "X",
+		Version:           "004010",
+	}
+
+	t.Run("Converts from a parsed segment", func(t *testing.T) {
+		parser := NewParser(strings.NewReader("GS*PO*SENDER*RECEIVER*20190430*1230*1*X*004010~"), WithDelimiters(DefaultDelimiters))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+
+		header, err := NewGSHeader(segments[0])
+		assert.NoError(t, err)
+		assert.Equal(t, want, header)
+	})
+
+	t.Run("Converts to a segment", func(t *testing.T) {
+		segment, err := want.Segment()
+		assert.NoError(t, err)
+		assert.Equal(t, "GS*PO*SENDER*RECEIVER*20190430*1230*1*X*004010~", segment.String())
+	})
+
+	t.Run("Seconds are kept", func(t *testing.T) {
+		header := want
+		header.Date = header.Date.Add(15 * time.Second)
+		segment, err := header.Segment()
+		assert.NoError(t, err)
+		assert.Equal(t, "123015", segment.Elements[4].Value)
+
+		segment.Elements[4].Value = "12301550"
+		converted, err := NewGSHeader(segment)
+		assert.NoError(t, err)
+		assert.Equal(t, header, converted)
+	})
+
+	t.Run("Invalid fields fail", func(t *testing.T) {
+		header := want
+		header.SenderCode = "A SENDER CODE LONGER THAN FIFTEEN"
+		_, err := header.Segment()
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+
+		header = want
+		header.FunctionalID = ""
+		_, err = header.Segment()
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+
+		header = want
+		header.ControlNumber = -1
+		_, err = header.Segment()
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+
+	t.Run("Invalid segments fail", func(t *testing.T) {
+		_, err := NewGSHeader(Segment{ID: "GS", Elements: Elements{{Value: "PO"}}})
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+
+		segment, _ := want.Segment()
+		segment.Elements[3].Value = "2019-04-30"
+		_, err = NewGSHeader(segment)
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+}
@@ -0,0 +1,42 @@
+package hedi
+
+import (
+	"io"
+)
+
+// Interchange represents a single ISA/IEA enveloped interchange together with
+// the Delimiters identified in its ISA segment.
+// Segments holds all the segments of the interchange, from its header to its trailer, and is what is written.
+// The envelope hierarchy of Header, FunctionalGroups and Trailer is built from Segments when the Interchange is
+// read by a Parser or built, and is not kept in step with later changes to Segments.
+type Interchange struct {
+	Delimiters Delimiters
+	Segments   Segments
+
+	Header           Segment
+	FunctionalGroups []FunctionalGroup
+	// Trailer is the IEA segment, or nil if it is missing.
+	Trailer *Segment
+}
+
+// String returns the string representation of the Interchange using its own Delimiters.
+func (i Interchange) String() string {
+	return i.Segments.DString(i.Delimiters)
+}
+
+// WriteTo satisfies the io.WriterTo interface, writing the Interchange using its own Delimiters.
+func (i Interchange) WriteTo(w io.Writer) (int64, error) {
+	return i.Segments.DWriteTo(i.Delimiters, w)
+}
+
+// withEnvelopes returns the Interchange with the envelope hierarchy built from its Segments. Structural
+// problems are left for Parser.Envelopes and Segments.Validate to report; the hierarchy stays empty if
+// the Segments do not start with an ISA segment.
+func (i Interchange) withEnvelopes() Interchange {
+	built, _ := envelopes(i.Segments, i.Delimiters)
+	if len(built) == 0 {
+		return i
+	}
+	i.Header, i.FunctionalGroups, i.Trailer = built[0].Header, built[0].FunctionalGroups, built[0].Trailer
+	return i
+}
@@ -0,0 +1,33 @@
+package hedi
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInterchange_String(t *testing.T) {
+	interchange := Interchange{
+		Delimiters: Delimiters{Segment: '\n', Element: '|', SubElement: ':'},
+		Segments: Segments{
+			Segment{ID: "GS", Elements: Elements{{Value: "PO"}}},
+			Segment{ID: "GE", Elements: Elements{{Value: "1", SubElements: []string{"2"}}}},
+		},
+	}
+	assert.Equal(t, "GS|PO\nGE|1:2\n", interchange.String())
+}
+
+func TestInterchange_WriteTo(t *testing.T) {
+	interchange := Interchange{
+		Delimiters: Delimiters{Segment: '\n', Element: '|', SubElement: ':'},
+		Segments: Segments{
+			Segment{ID: "GS", Elements: Elements{{Value: "PO"}}},
+		},
+	}
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := interchange.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.Equal(t, "GS|PO\n", buf.String())
+}
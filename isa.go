@@ -0,0 +1,172 @@
+package hedi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// isaLength is the fixed length in characters of an ISA segment, including its terminator.
+const isaLength = 106
+
+// isaFieldWidths holds the fixed widths of the ISA01 to ISA16 elements.
+var isaFieldWidths = [16]int{2, 10, 2, 10, 2, 15, 2, 15, 6, 4, 1, 5, 9, 1, 1, 1}
+
+// isaDateLayout and isaTimeLayout are the layouts of the ISA09 interchange date and ISA10 interchange time.
+const (
+	isaDateLayout = "060102"
+	isaTimeLayout = "1504"
+)
+
+var (
+	// ErrInvalidISA is returned when an ISA segment does not have the mandated fixed field widths.
+	ErrInvalidISA = errors.New("invalid ISA field widths")
+	// ErrInvalidHeader is returned when an ISA or GS segment cannot be converted to its typed header.
+	ErrInvalidHeader = errors.New("invalid envelope header")
+)
+
+// validateISA checks that the fixed-width fields of an ISA segment are separated by the element
+// separator at the mandated offsets, so that the delimiters at offsets 103 to 105 can be trusted.
+// The returned error is positioned relative to the start of the ISA segment, at the offset where the
+// separator following the field of invalid width was expected.
+func validateISA(isa string) error {
+	runes := []rune(isa)
+	if len(runes) < isaLength || string(runes[:3]) != "ISA" {
+		return newSyntaxError(ErrInvalidISA, Position{Segment: 1, Line: 1}, "ISA", isa)
+	}
+
+	separator := runes[3]
+	offset := 3
+	for i, width := range isaFieldWidths {
+		if runes[offset] != separator {
+			position := Position{Offset: int64(len(string(runes[:offset]))), Segment: 1, Element: i, Line: 1}
+			return newSyntaxError(ErrInvalidISA, position, "ISA", isa)
+		}
+		offset += width + 1
+	}
+	return nil
+}
+
+// ISAHeader is the typed form of an ISA interchange control header.
+// The ISA11 repetition separator, from version 00501, and the ISA16 sub-element separator are taken from
+// the Delimiters the header is written with.
+type ISAHeader struct {
+	AuthorizationQualifier   string // ISA01
+	AuthorizationInformation string // ISA02
+	SecurityQualifier        string // ISA03
+	SecurityInformation      string // ISA04
+	SenderQualifier          string // ISA05
+	SenderID                 string // ISA06
+	ReceiverQualifier        string // ISA07
+	ReceiverID               string // ISA08
+	// Date is the interchange date and time, ISA09 and ISA10, to the minute.
+	Date time.Time
+	// StandardsID is the ISA11 control standards identifier, "U", before version 00501.
+	StandardsID             string
+	Version                 string // ISA12
+	ControlNumber           int    // ISA13
+	AcknowledgmentRequested bool   // ISA14
+	// UsageIndicator is ISA15: "P" for production, "T" for test or "I" for information.
+	UsageIndicator string
+}
+
+// NewISAHeader converts an ISA segment to an ISAHeader, ignoring the space padding of its fields.
+// It returns a *SyntaxError wrapping ErrInvalidHeader if the segment is not a complete ISA segment,
+// or its date, time or control number are not numeric.
+func NewISAHeader(segment Segment) (ISAHeader, error) {
+	if segment.ID != "ISA" || len(segment.Elements) < len(isaFieldWidths) {
+		return ISAHeader{}, newSyntaxError(ErrInvalidHeader, segment.Position, segment.ID, "")
+	}
+	value := func(i int) string {
+		return strings.TrimSpace(segment.Elements[i-1].Value)
+	}
+	invalid := func(i int) error {
+		position := segment.Position
+		position.Element = i
+		return newSyntaxError(ErrInvalidHeader, position, segment.ID, segment.Elements[i-1].Value)
+	}
+
+	header := ISAHeader{
+		AuthorizationQualifier:   value(1),
+		AuthorizationInformation: value(2),
+		SecurityQualifier:        value(3),
+		SecurityInformation:      value(4),
+		SenderQualifier:          value(5),
+		SenderID:                 value(6),
+		ReceiverQualifier:        value(7),
+		ReceiverID:               value(8),
+		Version:                  value(12),
+		AcknowledgmentRequested:  value(14) == "1",
+		UsageIndicator:           value(15),
+	}
+	if header.Version < repetitionVersion {
+		header.StandardsID = value(11)
+	}
+
+	date, err := time.Parse(isaDateLayout+isaTimeLayout, value(9)+value(10))
+	if err != nil {
+		return ISAHeader{}, invalid(9)
+	}
+	header.Date = date
+	if header.ControlNumber, err = strconv.Atoi(value(13)); err != nil {
+		return ISAHeader{}, invalid(13)
+	}
+	return header, nil
+}
+
+// Segment converts the ISAHeader to an ISA segment, padding each field to its fixed width with spaces
+// and the control number with zeros. ISA11, from version 00501, and ISA16 are taken from delimiters.
+// It returns an error wrapping ErrInvalidISA if a field does not fit its width.
+func (h ISAHeader) Segment(delimiters Delimiters) (Segment, error) {
+	standardsID := h.StandardsID
+	if h.Version >= repetitionVersion {
+		if delimiters.Repetition == 0 {
+			return Segment{}, fmt.Errorf("%w: ISA11 requires a repetition separator from version %s", ErrInvalidISA, repetitionVersion)
+		}
+		standardsID = string(delimiters.Repetition)
+	}
+	if delimiters.SubElement == 0 {
+		return Segment{}, fmt.Errorf("%w: ISA16 requires a sub-element separator", ErrInvalidISA)
+	}
+	if h.ControlNumber < 0 {
+		return Segment{}, fmt.Errorf("%w: ISA13 %d is negative", ErrInvalidISA, h.ControlNumber)
+	}
+	acknowledgmentRequested := "0"
+	if h.AcknowledgmentRequested {
+		acknowledgmentRequested = "1"
+	}
+
+	values := [len(isaFieldWidths)]string{
+		h.AuthorizationQualifier,
+		h.AuthorizationInformation,
+		h.SecurityQualifier,
+		h.SecurityInformation,
+		h.SenderQualifier,
+		h.SenderID,
+		h.ReceiverQualifier,
+		h.ReceiverID,
+		h.Date.Format(isaDateLayout),
+		h.Date.Format(isaTimeLayout),
+		standardsID,
+		h.Version,
+		fmt.Sprintf("%0*d", isaFieldWidths[12], h.ControlNumber),
+		acknowledgmentRequested,
+		h.UsageIndicator,
+		string(delimiters.SubElement),
+	}
+
+	segment := NewSegment("ISA")
+	for i, value := range values {
+		width := isaFieldWidths[i]
+		if n := utf8.RuneCountInString(value); n > width {
+			return Segment{}, fmt.Errorf("%w: ISA%02d %q exceeds %d characters", ErrInvalidISA, i+1, value, width)
+		} else if n < width {
+			value += strings.Repeat(" ", width-n)
+		}
+		segment.AddElement(Element{Value: value})
+	}
+	return *segment, nil
+}
@@ -0,0 +1,126 @@
+package hedi
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateISA(t *testing.T) {
+	t.Run("Valid ISA succeeds", func(t *testing.T) {
+		isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+		assert.NoError(t, validateISA(isa))
+	})
+
+	t.Run("Short sender ID fails at ISA06", func(t *testing.T) {
+		isa := "ISA*00*          *00*          *ZZ*SENDER*ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~" + strings.Repeat(" ", 9)
+		err := validateISA(isa)
+		assert.ErrorIs(t, err, ErrInvalidISA)
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, 6, syntaxErr.Position.Element)
+		assert.Equal(t, int64(50), syntaxErr.Position.Offset)
+	})
+
+	t.Run("Missing identifier fails", func(t *testing.T) {
+		assert.ErrorIs(t, validateISA(strings.Repeat("*", isaLength)), ErrInvalidISA)
+	})
+}
+
+func TestISAHeader(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*^*00501*000000042*1*T*>~"
+	want := ISAHeader{
+		AuthorizationQualifier:  "00",
+		SecurityQualifier:       "00",
+		SenderQualifier:         "ZZ",
+		SenderID:                "SENDER",
+		ReceiverQualifier:       "ZZ",
+		ReceiverID:              "RECEIVER",
+		Date:                    time.Date(2019, 4, 30, 12, 30, 0, 0, time.UTC),
+		Version:                 "00501",
+		ControlNumber:           42,
+		AcknowledgmentRequested: true,
+		UsageIndicator:          "T",
+	}
+
+	t.Run("Converts from a parsed segment", func(t *testing.T) {
+		segments, err := NewParser(strings.NewReader(isa)).Segments()
+		assert.NoError(t, err)
+
+		header, err := NewISAHeader(segments[0])
+		assert.NoError(t, err)
+		assert.Equal(t, want, header)
+	})
+
+	t.Run("Converts to a fixed-width segment", func(t *testing.T) {
+		segment, err := want.Segment(DefaultDelimiters5010)
+		assert.NoError(t, err)
+		assert.Equal(t, isa, segment.DString(DefaultDelimiters5010))
+		assert.NoError(t, validateISA(segment.DString(DefaultDelimiters5010)))
+	})
+
+	t.Run("Pads short values", func(t *testing.T) {
+		header := want
+		header.SenderID = "ACME"
+		header.ControlNumber = 7
+		segment, err := header.Segment(DefaultDelimiters5010)
+		assert.NoError(t, err)
+		assert.Equal(t, "ACME           ", segment.Elements[5].Value)
+		assert.Equal(t, "000000007", segment.Elements[12].Value)
+
+		parsed, err := NewParser(strings.NewReader(segment.DString(DefaultDelimiters5010))).Segments()
+		assert.NoError(t, err)
+		assert.Len(t, parsed, 1)
+	})
+
+	t.Run("Uses the standards identifier before version 00501", func(t *testing.T) {
+		header := want
+		header.Version = "00401"
+		header.StandardsID = "U"
+		segment, err := header.Segment(Delimiters{Segment: '~', Element: '*', SubElement: ':'})
+		assert.NoError(t, err)
+		assert.Equal(t, "U", segment.Elements[10].Value)
+		assert.Equal(t, ":", segment.Elements[15].Value)
+
+		converted, err := NewISAHeader(segment)
+		assert.NoError(t, err)
+		assert.Equal(t, header, converted)
+	})
+
+	t.Run("Long values fail", func(t *testing.T) {
+		header := want
+		header.SenderID = "A SENDER ID LONGER THAN FIFTEEN"
+		_, err := header.Segment(DefaultDelimiters5010)
+		assert.ErrorIs(t, err, ErrInvalidISA)
+
+		header = want
+		header.ControlNumber = 1000000000
+		_, err = header.Segment(DefaultDelimiters5010)
+		assert.ErrorIs(t, err, ErrInvalidISA)
+	})
+
+	t.Run("Missing delimiters fail", func(t *testing.T) {
+		_, err := want.Segment(Delimiters{Segment: '~', Element: '*', SubElement: '>'})
+		assert.ErrorIs(t, err, ErrInvalidISA)
+
+		_, err = want.Segment(Delimiters{Segment: '~', Element: '*', Repetition: '^'})
+		assert.ErrorIs(t, err, ErrInvalidISA)
+	})
+
+	t.Run("Invalid segments fail", func(t *testing.T) {
+		_, err := NewISAHeader(Segment{ID: "GS"})
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+
+		segment, _ := want.Segment(DefaultDelimiters5010)
+		segment.Elements[12].Value = "00000000X"
+		_, err = NewISAHeader(segment)
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, 13, syntaxErr.Position.Element)
+	})
+}
@@ -2,59 +2,511 @@ package hedi
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"strings"
+	"unicode/utf8"
 )
 
+// cancellationInterval is the number of tokens or segments read between checks for the cancellation of a context.
+const cancellationInterval = 64
+
+// repetitionVersion is the first interchange control version (ISA12) in which ISA11 is the repetition separator.
+const repetitionVersion = "00501"
+
 var (
 	// ErrInvalidISALength represents an error for invalid ISA segment length.
 	ErrInvalidISALength = errors.New("invalid ISA length")
+	// ErrISANotFound is returned when no ISA segment is found while skipping a prefix.
+	ErrISANotFound = errors.New("ISA segment not found")
 )
 
 // Lexer wraps an io.Reader for lexing EDI files.
+// Input is consumed one segment at a time, so memory use is bounded by the
+// size of the largest segment rather than the size of the input.
+// Segments are lexed in place in the read buffer, and the buffers holding
+// tokens are reused from one segment to the next.
+// Streams containing several concatenated interchanges are supported; the
+// delimiters are re-derived from each ISA segment that follows an IEA segment.
 type Lexer struct {
-	reader io.Reader
+	reader     *bufio.Reader
+	config     config
+	delimiters Delimiters
+	terminator []byte
+	begun      bool
+	started    bool
+	ended      bool
+	pending    []RawToken
+	next       int
+	segment    []byte
+	offset     int64
+	text       string
+	textReady  bool
+	buffer     []byte
+	scratch    []byte
+	recording  bool
+	record     []byte
+	position   Position
+	lineEnding LineEnding
+	wrapWidth  int
+	prefix     []byte
+}
+
+// NewLexer initializes a new Lexer with a given io.Reader and optional Options.
+// Unless delimiters are supplied WithDelimiters, the input must start with an ISA segment.
+func NewLexer(reader io.Reader, opts ...Option) *Lexer {
+	config := newConfig(opts)
+	if config.maxBytes > 0 {
+		reader = &limitReader{reader: reader, remaining: config.maxBytes}
+	}
+	l := &Lexer{
+		reader: bufio.NewReader(reader),
+		config: config,
+		position: Position{
+			Line: 1,
+		},
+	}
+	if l.config.delimiters != nil {
+		l.setDelimiters(*l.config.delimiters)
+		l.started = true
+	}
+	return l
+}
+
+// Next returns the next Token from the input.
+// It returns io.EOF once the input has been fully consumed. After an error wrapping ErrInvalidCharacter,
+// subsequent calls return the tokens of the offending segment.
+func (l *Lexer) Next() (Token, error) {
+	token, err := l.NextRaw()
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Type: token.Type, Value: l.string(token), Position: token.Position}, nil
 }
 
-// NewLexer initializes a new Lexer with a given io.Reader.
-func NewLexer(reader io.Reader) *Lexer {
-	return &Lexer{
-		reader: reader,
+// NextRaw returns the next RawToken from the input without copying its value, which is only valid until
+// the next call to NextRaw or Next. It otherwise behaves like Next.
+func (l *Lexer) NextRaw() (RawToken, error) {
+	for l.next >= len(l.pending) {
+		if err := l.lexNext(); err != nil {
+			return RawToken{}, err
+		}
 	}
+	token := l.pending[l.next]
+	l.next++
+	return token, nil
+}
+
+// string returns the value of a token of the current segment as a string. Values appearing verbatim in the
+// segment share the memory of a single copy of the segment, so that one string is allocated per segment.
+func (l *Lexer) string(token RawToken) string {
+	if !l.textReady {
+		l.text, l.textReady = string(l.segment), true
+	}
+	start := token.Position.Offset - l.offset
+	end := start + int64(len(token.Value))
+	if start >= 0 && end <= int64(len(l.text)) && l.text[start:end] == string(token.Value) {
+		return l.text[start:end]
+	}
+	return string(token.Value)
+}
+
+// Delimiters returns the delimiters of the interchange currently being lexed.
+// It returns the zero value until the first ISA segment has been lexed.
+func (l *Lexer) Delimiters() Delimiters {
+	return l.delimiters
+}
+
+// LineEnding returns the line break style separating segments, as detected following the first ISA segment.
+func (l *Lexer) LineEnding() LineEnding {
+	return l.lineEnding
+}
+
+// WrapWidth returns the line width at which the input was detected to be hard-wrapped,
+// or 0 if unwrapping is disabled or the input is not wrapped.
+func (l *Lexer) WrapWidth() int {
+	return l.wrapWidth
+}
+
+// Prefix returns the input skipped before the first ISA segment when WithSkipPrefix is enabled.
+func (l *Lexer) Prefix() []byte {
+	return l.prefix
 }
 
-// Tokens lexes the input and returns a slice of Token structs.
+// Tokens lexes the input and returns a slice of Token structs, delegating to TokensContext.
 // It expects an input that starts with a valid ISA segment of 106 bytes.
 // Returns an error if the input does not meet the criteria.
 func (l *Lexer) Tokens() ([]Token, error) {
-	isaTokens, separators, err := lexISA(l.reader)
-	if err != nil {
-		return []Token{}, err
+	return l.TokensContext(context.Background())
+}
+
+// TokensContext lexes the input and returns a slice of Token structs, checking periodically whether ctx is done.
+// If so, it stops and returns a *ContextError wrapping ctx.Err() with the position reached.
+func (l *Lexer) TokensContext(ctx context.Context) ([]Token, error) {
+	var tokens []Token
+	for i := 0; ; i++ {
+		if err := l.checkContext(ctx, i); err != nil {
+			return []Token{}, err
+		}
+		token, err := l.Next()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return []Token{}, err
+		}
+		tokens = append(tokens, token)
 	}
-	return append(isaTokens, lexSegments(l.reader, separators)...), nil
 }
 
-// lexISA tokenizes the ISA segment and returns the identified delimiters.
-func lexISA(reader io.Reader) ([]Token, Delimiters, error) {
-	isaBuffer := make([]byte, 106)
-	n, err := reader.Read(isaBuffer)
+// checkContext returns a *ContextError if ctx is done, checking only every cancellationInterval iterations.
+func (l *Lexer) checkContext(ctx context.Context, iteration int) error {
+	if iteration%cancellationInterval != 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return &ContextError{Err: err, Position: l.position}
+	}
+	return nil
+}
+
+// lexNext lexes the next segment of the input into the pending token buffer.
+// The ISA segment is lexed first to identify the delimiters for the remaining segments,
+// and again whenever a new interchange begins after an IEA segment.
+func (l *Lexer) lexNext() error {
+	l.pending, l.next = l.pending[:0], 0
+
+	segment, n, err := l.scanNext()
+	if err != nil || len(l.pending) > 0 {
+		return err // ISA segments are lexed while scanning
+	}
+
+	l.position.Segment++
+	l.lexSegment(segment, l.position)
+	l.consume(segment, n)
+
+	if err := checkLimits(l.pending, l.config); err != nil {
+		l.pending = l.pending[:0]
+		return err
+	}
+
+	if l.config.charset != nil {
+		return validateCharset(l.pending, l.config.charset, l.segment, l.offset, l.delimiters.Release)
+	}
+	return nil
+}
+
+// scanNext reads the next segment of the input and returns it along with the number of bytes it spans,
+// leaving it to the caller to count and consume it. ISA segments are instead lexed into the pending token buffer
+// and consumed, as their delimiters apply to the following segments.
+func (l *Lexer) scanNext() ([]byte, int, error) {
+	if !l.begun {
+		l.begun = true
+		if err := l.begin(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if !l.started {
+		return nil, 0, l.lexHeader()
+	}
+
+	for {
+		if l.ended || l.config.whitespace == TrimWhitespace {
+			if err := l.skipWhitespace(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if l.ended {
+			l.ended = false
+			if prefix, _ := l.reader.Peek(3); string(prefix) == "ISA" {
+				return nil, 0, l.lexHeader()
+			}
+		}
+
+		segment, n, err := l.readSegment()
+		if err == ErrSegmentTooLong {
+			position := l.position
+			position.Segment++
+			return nil, 0, newSyntaxError(err, position, "", string(segment))
+		}
+		if err != nil {
+			return nil, 0, l.wrap(err)
+		}
+
+		// Blank lines are skipped when trimming whitespace
+		if len(segment) == 0 && l.config.whitespace == TrimWhitespace && isLineBreak(l.delimiters.Segment) {
+			l.consume(segment, n)
+			continue
+		}
+
+		if err := l.checkSegmentCount(); err != nil {
+			return nil, 0, err
+		}
+
+		id, _, _ := cut(segment, l.delimiters.Element, l.delimiters.Release)
+		l.ended = string(trimLineBreaks(id)) == "IEA"
+		return segment, n, nil
+	}
+}
+
+// begin prepares the start of the input for lexing, unwrapping it and skipping any leading
+// whitespace and prefix as configured.
+func (l *Lexer) begin() error {
+	if l.config.unwrap {
+		l.unwrap()
+	}
+	if err := l.skipLeadingWhitespace(); err != nil {
+		if err == io.EOF && !l.started {
+			return nil // Reported as an invalid ISA segment
+		}
+		return err
+	}
+	if l.config.skipPrefix && !l.started {
+		return l.skipPrefix()
+	}
+	return nil
+}
+
+// lexHeader lexes an ISA segment into the pending token buffer and adopts its delimiters.
+func (l *Lexer) lexHeader() error {
+	if err := l.checkSegmentCount(); err != nil {
+		return err
+	}
+
+	tokens, delimiters, err := lexISA(l.reader)
 	if err != nil {
-		return []Token{}, Delimiters{}, err
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) {
+			syntaxErr.Position = syntaxErr.Position.from(l.position)
+		}
+		return err
+	}
+	delimiters.Release = l.config.release
+	if !l.started {
+		following, _ := l.reader.Peek(2)
+		l.lineEnding = detectLineEnding(delimiters.Segment, following)
+	}
+	l.started = true
+	l.setDelimiters(delimiters)
+
+	// Tokens are positioned relative to the start of the ISA segment
+	for _, token := range tokens {
+		position := token.Position.from(l.position)
+		l.pending = append(l.pending, RawToken{Type: token.Type, Value: []byte(token.Value), Position: position})
+	}
+
+	isa := isaSegment(tokens)
+	l.text, l.textReady, l.offset = isa, true, l.position.Offset
+	l.position.Segment++
+	l.consume([]byte(isa), len(isa)+utf8.RuneLen(delimiters.Segment))
+	return nil
+}
+
+// setDelimiters adopts the delimiters of the interchange being lexed.
+func (l *Lexer) setDelimiters(delimiters Delimiters) {
+	l.delimiters = delimiters
+	l.terminator = []byte(string(delimiters.Segment))
+}
+
+// checkSegmentCount returns an ErrTooManySegments if the next segment would exceed the maximum number of segments.
+func (l *Lexer) checkSegmentCount() error {
+	if l.config.maxSegments > 0 && l.position.Segment >= l.config.maxSegments {
+		return l.wrap(ErrTooManySegments)
+	}
+	return nil
+}
+
+// wrap returns err as a SyntaxError positioned at the start of the next segment.
+// io.EOF is returned unwrapped, as it signals the regular end of the input.
+func (l *Lexer) wrap(err error) error {
+	if err == io.EOF {
+		return err
+	}
+	position := l.position
+	position.Segment++
+	return newSyntaxError(err, position, "", "")
+}
+
+// consume advances the position of the lexer past n bytes of input holding the given segment.
+// When recording, the consumed input, including any terminator, is appended to the record.
+func (l *Lexer) consume(segment []byte, n int) {
+	l.position.Line += bytes.Count(segment, []byte{'\n'})
+	if n > len(segment) && l.delimiters.Segment == '\n' {
+		l.position.Line++
 	}
-	if n != 106 {
-		return []Token{}, Delimiters{}, ErrInvalidISALength
+	l.position.Offset += int64(n)
+
+	if l.recording {
+		l.record = append(l.record, segment...)
+		l.record = append(l.record, l.terminator[:n-len(segment)]...)
+	}
+}
+
+// snapshot holds the state of a Lexer between two segments, from which lexing can be resumed.
+type snapshot struct {
+	delimiters Delimiters
+	started    bool
+	ended      bool
+	position   Position
+	lineEnding LineEnding
+}
+
+// snapshot returns the current state of the Lexer.
+func (l *Lexer) snapshot() snapshot {
+	return snapshot{
+		delimiters: l.delimiters,
+		started:    l.started,
+		ended:      l.ended,
+		position:   l.position,
+		lineEnding: l.lineEnding,
+	}
+}
+
+// resume returns a Lexer with the given config that lexes input as the continuation of the input
+// lexed up to the snapshot.
+func (s snapshot) resume(input []byte, c config) *Lexer {
+	l := &Lexer{
+		reader:     bufio.NewReader(bytes.NewReader(input)),
+		config:     c,
+		begun:      true,
+		started:    s.started,
+		ended:      s.ended,
+		position:   s.position,
+		lineEnding: s.lineEnding,
+	}
+	l.setDelimiters(s.delimiters)
+	return l
+}
+
+// unwrap detects whether the input is hard-wrapped and, if so, removes its line breaks.
+func (l *Lexer) unwrap() {
+	start, _ := l.reader.Peek(l.reader.Size())
+	if i := bytes.Index(start, []byte("ISA")); i > 0 && l.config.skipPrefix {
+		start = start[i:]
+	}
+	l.wrapWidth = wrapWidth(start)
+	if l.wrapWidth > 0 {
+		l.reader = bufio.NewReader(&unwrapReader{reader: l.reader})
+	}
+}
+
+// skipPrefix discards any input preceding the first valid ISA segment, retaining it as the prefix.
+// Occurrences of "ISA" that do not start a segment with valid field widths are treated as part of the prefix.
+func (l *Lexer) skipPrefix() error {
+	for {
+		buffered, err := l.reader.Peek(l.reader.Size())
+		if err != nil && err != io.EOF {
+			return l.wrap(err)
+		}
+		i := bytes.Index(buffered, []byte("ISA"))
+		if i < 0 {
+			if err != nil {
+				l.discardPrefix(len(buffered))
+				return newSyntaxError(ErrISANotFound, l.position, "", string(l.prefix))
+			}
+			// Retain a possible partial "ISA" at the end of the buffer
+			l.discardPrefix(len(buffered) - 2)
+			continue
+		}
+		l.discardPrefix(i)
+
+		candidate, _ := l.reader.Peek(isaLength * utf8.UTFMax)
+		if utf8.RuneCount(candidate) < isaLength || validateISA(string(candidate)) == nil {
+			return nil
+		}
+		l.discardPrefix(1)
+	}
+}
+
+// discardPrefix discards the next n bytes of input, appending them to the prefix.
+func (l *Lexer) discardPrefix(n int) {
+	skipped, _ := l.reader.Peek(n)
+	l.prefix = append(l.prefix, skipped...)
+	l.consume(skipped, len(skipped))
+	_, _ = l.reader.Discard(len(skipped))
+}
+
+// skipLeadingWhitespace discards a byte order mark and any whitespace preceding the first ISA segment
+// when trimming whitespace.
+func (l *Lexer) skipLeadingWhitespace() error {
+	if l.config.whitespace != TrimWhitespace {
+		return nil
 	}
+	if prefix, _ := l.reader.Peek(len(byteOrderMark)); string(prefix) == byteOrderMark {
+		if _, err := l.reader.Discard(len(byteOrderMark)); err != nil {
+			return l.wrap(err)
+		}
+		l.consume([]byte(byteOrderMark), len(byteOrderMark))
+	}
+	return l.skipWhitespace()
+}
 
-	isaString := string(isaBuffer)
-	elementSeparator := isaString[103]
-	subElementSeparator := isaString[104]
-	segmentSeparator := isaString[105]
+// skipWhitespace discards the whitespace preceding the next segment, unless it is the segment terminator itself.
+// Line breaks are always discarded, spaces only when trimming whitespace.
+// Returns io.EOF if no input remains.
+func (l *Lexer) skipWhitespace() error {
+	for {
+		b, err := l.reader.Peek(1)
+		if err != nil {
+			return l.wrap(err)
+		}
+		if !l.skippable(rune(b[0])) {
+			return nil
+		}
+		l.consume(b, 1)
+		if _, err := l.reader.Discard(1); err != nil {
+			return l.wrap(err)
+		}
+	}
+}
 
+// skippable reports whether r may be discarded as whitespace between segments.
+func (l *Lexer) skippable(r rune) bool {
+	if r == l.delimiters.Segment {
+		return false
+	}
+	return isLineBreak(r) || (r == ' ' && l.config.whitespace == TrimWhitespace)
+}
+
+// lexISA tokenizes the ISA segment and returns the identified delimiters.
+// Token and error positions are relative to the start of the ISA segment.
+func lexISA(reader *bufio.Reader) ([]Token, Delimiters, error) {
+	start := Position{Segment: 1, Line: 1}
+
+	// Read the header character by character, as delimiters may be encoded in several bytes
+	var sb strings.Builder
+	for count := 0; count < isaLength; count++ {
+		r, size, err := reader.ReadRune()
+		if err == io.EOF {
+			return []Token{}, Delimiters{}, newSyntaxError(ErrInvalidISALength, start, "ISA", sb.String())
+		}
+		if err != nil {
+			return []Token{}, Delimiters{}, newSyntaxError(err, start, "ISA", sb.String())
+		}
+		if r == utf8.RuneError && size == 1 {
+			// Retain invalid bytes as they are rather than replacing them
+			_ = reader.UnreadRune()
+			b, _ := reader.ReadByte()
+			sb.WriteByte(b)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	isaString := sb.String()
+	if err := validateISA(isaString); err != nil {
+		return []Token{}, Delimiters{}, err
+	}
+
+	isaRunes := []rune(isaString)
 	separators := &Delimiters{
-		Segment:    rune(segmentSeparator),
-		Element:    rune(elementSeparator),
-		SubElement: rune(subElementSeparator),
+		Segment:    isaRunes[105],
+		Element:    isaRunes[103],
+		SubElement: isaRunes[104],
 	}
 
 	var tokens []Token
@@ -62,96 +514,242 @@ func lexISA(reader io.Reader) ([]Token, Delimiters, error) {
 	// Split the segment into its identifier and elements
 	segmentParts := strings.Split(isaString, string(separators.Element))
 
-	// Record segment identifier and consumed delimiter token
-	tokens = append(tokens,
-		Token{Type: SegmentIdentifier, Value: segmentParts[0]},
-		Token{Type: ElementDelimiter, Value: string(separators.Element)},
-	)
+	// From version 00501 onwards ISA11 holds the repetition separator
+	if len(segmentParts) > 12 && utf8.RuneCountInString(segmentParts[11]) == 1 && segmentParts[12] >= repetitionVersion {
+		separators.Repetition, _ = utf8.DecodeRuneInString(segmentParts[11])
+	}
+
+	c := &cursor{text: []byte(isaString), position: start}
 
-	// Record each element in the segment, starting after the identifier, ending before the sub element delimiter value
+	// Record segment identifier
+	tokens = append(tokens, Token{Type: SegmentIdentifier, Value: segmentParts[0], Position: c.position})
+	c.advance(len(segmentParts[0]))
+
+	// Record each element in the segment and its consumed delimiter, starting after the identifier,
+	// ending before the sub element delimiter value
 	for i, part := range segmentParts[1 : len(segmentParts)-1] {
-		tokens = append(tokens, Token{Type: ElementValue, Value: part})
-		if i < len(segmentParts)-2 { // Add consumed delimiter if not the last element
-			tokens = append(tokens, Token{Type: ElementDelimiter, Value: string(separators.Element)})
-		}
+		c.position.Element = i + 1
+		tokens = append(tokens, Token{Type: ElementDelimiter, Value: string(separators.Element), Position: c.position})
+		c.advance(utf8.RuneLen(separators.Element))
+		tokens = append(tokens, Token{Type: ElementValue, Value: part, Position: c.position})
+		c.advance(len(part))
 	}
 
 	// Record the sub element delimiter value and segment terminator
-	tokens = append(tokens,
-		Token{Type: ElementValue, Value: string(separators.SubElement)},
-		Token{Type: SegmentTerminator, Value: string(separators.Segment)},
-	)
+	c.position.Element++
+	tokens = append(tokens, Token{Type: ElementDelimiter, Value: string(separators.Element), Position: c.position})
+	c.advance(utf8.RuneLen(separators.Element))
+	tokens = append(tokens, Token{Type: ElementValue, Value: string(separators.SubElement), Position: c.position})
+	c.advance(utf8.RuneLen(separators.SubElement))
+	c.position.Element = 0
+	tokens = append(tokens, Token{Type: SegmentTerminator, Value: string(separators.Segment), Position: c.position})
 
 	return tokens, *separators, nil
 }
 
-// lexSegments tokenizes all subsequent segments in the EDI file using the delimiters identified in the ISA segment.
-func lexSegments(reader io.Reader, separators Delimiters) []Token {
-	var tokens []Token
+// isaSegment reconstructs the text of an ISA segment, excluding its terminator, from its tokens.
+func isaSegment(tokens []Token) string {
+	var sb strings.Builder
+	for _, token := range tokens[:len(tokens)-1] {
+		sb.WriteString(token.Value)
+	}
+	return sb.String()
+}
+
+// readSegment reads the next segment from the input, excluding its terminator,
+// and returns it along with the number of bytes consumed.
+// The segment refers to the read buffer, or to the Lexer's buffer if it spans several reads,
+// and is only valid until the next read.
+// Terminators escaped by the release character do not end the segment.
+// A final segment without a terminator is returned as is; io.EOF is returned once no input remains.
+// If a maximum segment length is set, reading stops with ErrSegmentTooLong as soon as the segment exceeds it,
+// returning the part of the segment read so far.
+func (l *Lexer) readSegment() ([]byte, int, error) {
+	terminator := l.terminator
+	maxLength := l.config.maxSegmentLength
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(splitter(separators.Segment))
+	var segment []byte
+	buffered := false
+	for {
+		// Read up to the last byte of the terminator, which may be encoded in several bytes
+		chunk, err := l.reader.ReadSlice(terminator[len(terminator)-1])
+		if buffered {
+			segment = append(segment, chunk...)
+			l.buffer = segment[:0]
+		} else {
+			segment = chunk
+		}
+		if maxLength > 0 && len(segment) > maxLength+len(terminator) {
+			return bytes.TrimSuffix(segment, terminator), 0, ErrSegmentTooLong
+		}
 
-	for scanner.Scan() {
-		segment := scanner.Text()
-		tokens = append(tokens, lexSegment(strings.NewReader(segment), separators)...)
+		body, complete := segment, false
+		switch {
+		case err == bufio.ErrBufferFull:
+		case err == io.EOF && len(segment) > 0:
+			complete = true
+		case err != nil:
+			return nil, 0, err
+		case bytes.HasSuffix(segment, terminator):
+			body = segment[:len(segment)-len(terminator)]
+			complete = !escaped(body, l.delimiters.Release)
+		}
+
+		if !complete {
+			// The read buffer is overwritten by the next read
+			if !buffered {
+				segment, buffered = append(l.buffer[:0], segment...), true
+			}
+			continue
+		}
+		if maxLength > 0 && len(body) > maxLength {
+			return body, 0, ErrSegmentTooLong
+		}
+		return body, len(segment), nil
 	}
+}
 
-	return tokens
+// escaped reports whether the character following s is escaped,
+// that is whether s ends in an odd number of release characters.
+func escaped(s []byte, release rune) bool {
+	if release == 0 {
+		return false
+	}
+	var encoded [utf8.UTFMax]byte
+	n := utf8.EncodeRune(encoded[:], release)
+	count := 0
+	for bytes.HasSuffix(s, encoded[:n]) {
+		s = s[:len(s)-n]
+		count++
+	}
+	return count%2 == 1
 }
 
-// lexSegment tokenizes a single segment using the provided delimiters.
-func lexSegment(reader io.Reader, separators Delimiters) []Token {
-	var tokens []Token
+// cut slices s around the first separator not escaped by the release character, returning the text
+// before and after it, and whether a separator was found.
+// Escape sequences are preserved so that the parts can be cut further.
+func cut(s []byte, separator, release rune) (before, after []byte, found bool) {
+	if release == 0 {
+		i := bytes.IndexRune(s, separator)
+		if i < 0 {
+			return s, nil, false
+		}
+		return s[:i], s[i+utf8.RuneLen(separator):], true
+	}
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(splitter(separators.Element))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRune(s[i:])
+		switch r {
+		case release:
+			_, escapedSize := utf8.DecodeRune(s[i+size:])
+			i += size + escapedSize // Skip the escaped character
+			continue
+		case separator:
+			return s[:i], s[i+size:], true
+		}
+		i += size
+	}
+	return s, nil, false
+}
+
+// unescape appends s to dst with its release characters removed, keeping the characters they escape.
+func unescape(dst, s []byte, release rune) []byte {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRune(s[i:])
+		if r == release && release != 0 && i+size < len(s) {
+			i += size
+			_, size = utf8.DecodeRune(s[i:])
+		}
+		dst = append(dst, s[i:i+size]...)
+		i += size
+	}
+	return dst
+}
 
-	scanner.Scan() // First scan should always be the segment identifier
-	tokens = append(tokens, Token{Type: SegmentIdentifier, Value: scanner.Text()})
+// lexSegment lexes the text of a single segment starting at position into the pending token buffer.
+// Token values refer to the text of the segment, unless they must be unescaped.
+func (l *Lexer) lexSegment(segment []byte, position Position) {
+	l.segment, l.offset, l.textReady = segment, position.Offset, false
+	l.scratch = l.scratch[:0]
 
-	for scanner.Scan() {
-		element := scanner.Text()
-		tokens = append(tokens, lexElement(strings.NewReader(element), separators)...)
+	d := l.delimiters
+	c := &cursor{text: segment, position: position}
+
+	// The first part is always the segment identifier
+	id, rest, more := cut(segment, d.Element, d.Release)
+	l.lexValue(SegmentIdentifier, id, c)
+
+	for element := 1; more; element++ {
+		var value []byte
+		value, rest, more = cut(rest, d.Element, d.Release)
+		c.position.Element = element
+		l.lexElement(value, c)
 	}
 
-	return append(tokens, Token{Type: SegmentTerminator, Value: string(separators.Segment)})
+	c.position.Element = 0
+	l.pending = append(l.pending, RawToken{Type: SegmentTerminator, Value: l.terminator, Position: c.position})
 }
 
-// lexElement tokenizes an element and its sub-elements, if any, using the provided delimiters.
-func lexElement(reader io.Reader, separators Delimiters) []Token {
-	var tokens []Token
+// lexElement lexes an element, its sub-elements and its repetitions, if any, into the pending token buffer.
+func (l *Lexer) lexElement(element []byte, c *cursor) {
+	d := l.delimiters
+	l.pending = append(l.pending, c.token(ElementDelimiter, utf8.RuneLen(d.Element)))
+
+	repetition, rest, more := element, []byte(nil), false
+	if d.Repetition != 0 {
+		repetition, rest, more = cut(element, d.Repetition, d.Release)
+	}
+	l.lexComposite(repetition, ElementValue, c)
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(splitter(separators.SubElement))
+	for more { // Any subsequent parts are repetitions
+		repetition, rest, more = cut(rest, d.Repetition, d.Release)
+		l.pending = append(l.pending, c.token(RepetitionDelimiter, utf8.RuneLen(d.Repetition)))
+		l.lexComposite(repetition, RepetitionValue, c)
+	}
+}
 
-	scanner.Scan() // First scan should always be the element
-	tokens = append(tokens, Token{Type: ElementDelimiter, Value: string(separators.Element)})
+// lexComposite lexes a value of the given type followed by its sub-elements, if any, into the pending token buffer.
+func (l *Lexer) lexComposite(composite []byte, valueType TokenType, c *cursor) {
+	d := l.delimiters
+	value, rest, more := cut(composite, d.SubElement, d.Release)
+	l.lexValue(valueType, value, c)
 
-	tokens = append(tokens, Token{Type: ElementValue, Value: scanner.Text()})
+	for more { // Any subsequent parts are sub elements
+		value, rest, more = cut(rest, d.SubElement, d.Release)
+		l.pending = append(l.pending, c.token(SubElementDelimiter, utf8.RuneLen(d.SubElement)))
+		l.lexValue(SubElementValue, value, c)
+	}
+}
 
-	var subElementTokens []Token
-	for scanner.Scan() { // Any subsequent scans are sub elements
-		subElementTokens = append(subElementTokens, Token{Type: SubElementDelimiter, Value: string(separators.SubElement)})
-		subElementTokens = append(subElementTokens, Token{Type: SubElementValue, Value: scanner.Text()})
+// lexValue appends a value of the given type to the pending token buffer. Values containing release
+// characters are unescaped into the scratch buffer.
+func (l *Lexer) lexValue(valueType TokenType, value []byte, c *cursor) {
+	token := c.token(valueType, len(value))
+	if release := l.delimiters.Release; release != 0 && bytes.ContainsRune(value, release) {
+		start := len(l.scratch)
+		l.scratch = unescape(l.scratch, value, release)
+		token.Value = l.scratch[start:len(l.scratch):len(l.scratch)]
 	}
+	l.pending = append(l.pending, token)
+}
 
-	return append(tokens, subElementTokens...)
+// cursor tracks the Position of consecutive tokens within the text of a segment.
+type cursor struct {
+	text     []byte
+	index    int
+	position Position
 }
 
-// splitter returns a bufio.SplitFunc function for use in bufio.Scanner.
-// The returned function splits the data into tokens separated by the given rune.
-// This is commonly used for parsing segments, elements, or sub-elements in EDI files.
-func splitter(separator rune) func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		for i := 0; i < len(data); i++ {
-			if data[i] == byte(separator) {
-				return i + 1, data[:i], nil
-			}
-		}
-		if atEOF && len(data) != 0 {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	}
+// token returns a RawToken of the given type spanning the next n bytes of text, and advances the cursor past them.
+func (c *cursor) token(tokenType TokenType, n int) RawToken {
+	token := RawToken{Type: tokenType, Value: c.text[c.index : c.index+n : c.index+n], Position: c.position}
+	c.advance(n)
+	return token
+}
+
+// advance moves the cursor forward by n bytes, counting any line feeds passed over.
+func (c *cursor) advance(n int) {
+	c.position.Line += bytes.Count(c.text[c.index:c.index+n], []byte{'\n'})
+	c.position.Offset += int64(n)
+	c.index += n
 }
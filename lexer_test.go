@@ -1,10 +1,17 @@
 package hedi
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestLexISA(t *testing.T) {
@@ -13,7 +20,7 @@ func TestLexISA(t *testing.T) {
 		assert.NoError(t, err)
 		defer file.Close()
 
-		tokens, separators, err := lexISA(file)
+		tokens, separators, err := lexISA(bufio.NewReader(file))
 		assert.NoError(t, err)
 		assert.Equal(t, 34, len(tokens))
 		assert.Equal(t, int32(10), separators.Segment)
@@ -25,7 +32,7 @@ func TestLexISA(t *testing.T) {
 		assert.NoError(t, err)
 		defer file.Close()
 
-		tokens, separators, err := lexISA(file)
+		tokens, separators, err := lexISA(bufio.NewReader(file))
 		assert.NoError(t, err)
 		assert.Equal(t, 34, len(tokens))
 		assert.Equal(t, int32(126), separators.Segment)
@@ -34,6 +41,21 @@ func TestLexISA(t *testing.T) {
 	})
 }
 
+func TestLexISA_Repetition(t *testing.T) {
+	t.Run("Version 00501 uses ISA11 as repetition separator", func(t *testing.T) {
+		reader := strings.NewReader("ISA*00*          *00*          *ZZ*EMEDNYBAT      *ZZ*ETIN           *030219*1140*^*00501*006097493*0*T*:~")
+		_, separators, err := lexISA(bufio.NewReader(reader))
+		assert.NoError(t, err)
+		assert.Equal(t, '^', separators.Repetition)
+	})
+	t.Run("Version 00401 has no repetition separator", func(t *testing.T) {
+		reader := strings.NewReader("ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~")
+		_, separators, err := lexISA(bufio.NewReader(reader))
+		assert.NoError(t, err)
+		assert.Equal(t, rune(0), separators.Repetition)
+	})
+}
+
 func TestLexer_Tokens(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
@@ -78,3 +100,471 @@ func TestLexer_Tokens(t *testing.T) {
 		})
 	}
 }
+
+func TestLexer_Next(t *testing.T) {
+	t.Run("Yields tokens one at a time until EOF", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		lexer := NewLexer(file)
+		count := 0
+		for {
+			_, err := lexer.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			count++
+		}
+		assert.Equal(t, 504, count)
+	})
+
+	t.Run("Lexes segments following the ISA", func(t *testing.T) {
+		input := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~GS*PO>1~"
+		lexer := NewLexer(strings.NewReader(input))
+		for i := 0; i < 34; i++ {
+			_, err := lexer.Next()
+			assert.NoError(t, err)
+		}
+
+		expected := []Token{
+			{Type: SegmentIdentifier, Value: "GS", Position: Position{Offset: 106, Segment: 2, Element: 0, Line: 1}},
+			{Type: ElementDelimiter, Value: "*", Position: Position{Offset: 108, Segment: 2, Element: 1, Line: 1}},
+			{Type: ElementValue, Value: "PO", Position: Position{Offset: 109, Segment: 2, Element: 1, Line: 1}},
+			{Type: SubElementDelimiter, Value: ">", Position: Position{Offset: 111, Segment: 2, Element: 1, Line: 1}},
+			{Type: SubElementValue, Value: "1", Position: Position{Offset: 112, Segment: 2, Element: 1, Line: 1}},
+			{Type: SegmentTerminator, Value: "~", Position: Position{Offset: 113, Segment: 2, Element: 0, Line: 1}},
+		}
+		for _, want := range expected {
+			token, err := lexer.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, want, token)
+		}
+
+		_, err := lexer.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("Returns error from invalid ISA", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader("ISA*00*"))
+		_, err := lexer.Next()
+		assert.ErrorIs(t, err, ErrInvalidISALength)
+	})
+}
+
+func TestLexer_Delimiters(t *testing.T) {
+	file, err := os.Open("./test/multiple_interchanges.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	lexer := NewLexer(file)
+	var delimiters []Delimiters
+	for {
+		token, err := lexer.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if token.Type == SegmentIdentifier && token.Value == "ISA" {
+			// Delimiters are identified once the ISA has been lexed
+			_, err := lexer.Next()
+			assert.NoError(t, err)
+			delimiters = append(delimiters, lexer.Delimiters())
+		}
+	}
+
+	assert.Equal(t, []Delimiters{
+		{Segment: '~', Element: '*', SubElement: '>'},
+		{Segment: '\n', Element: '|', SubElement: ':'},
+	}, delimiters)
+}
+
+func TestLexer_Next_Repetitions(t *testing.T) {
+	input := "ISA*00*          *00*          *ZZ*EMEDNYBAT      *ZZ*ETIN           *030219*1140*^*00501*006097493*0*T*:~HI*ABK:I10^ABF:I11~"
+	lexer := NewLexer(strings.NewReader(input))
+	for i := 0; i < 34; i++ {
+		_, err := lexer.Next()
+		assert.NoError(t, err)
+	}
+
+	expected := []Token{
+		{Type: SegmentIdentifier, Value: "HI"},
+		{Type: ElementDelimiter, Value: "*"},
+		{Type: ElementValue, Value: "ABK"},
+		{Type: SubElementDelimiter, Value: ":"},
+		{Type: SubElementValue, Value: "I10"},
+		{Type: RepetitionDelimiter, Value: "^"},
+		{Type: RepetitionValue, Value: "ABF"},
+		{Type: SubElementDelimiter, Value: ":"},
+		{Type: SubElementValue, Value: "I11"},
+		{Type: SegmentTerminator, Value: "~"},
+	}
+	for _, want := range expected {
+		token, err := lexer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, want, Token{Type: token.Type, Value: token.Value})
+	}
+}
+
+func TestLexer_Next_Release(t *testing.T) {
+	input := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~MSG*5?*3?>2?~?? done>x~"
+	lexer := NewLexer(strings.NewReader(input), WithRelease('?'))
+	for i := 0; i < 34; i++ {
+		_, err := lexer.Next()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, '?', lexer.Delimiters().Release)
+
+	expected := []Token{
+		{Type: SegmentIdentifier, Value: "MSG"},
+		{Type: ElementDelimiter, Value: "*"},
+		{Type: ElementValue, Value: "5*3>2~? done"},
+		{Type: SubElementDelimiter, Value: ">"},
+		{Type: SubElementValue, Value: "x"},
+		{Type: SegmentTerminator, Value: "~"},
+	}
+	for _, want := range expected {
+		token, err := lexer.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, want, Token{Type: token.Type, Value: token.Value})
+	}
+
+	_, err := lexer.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestCut(t *testing.T) {
+	tests := []struct {
+		input     string
+		separator rune
+		release   rune
+		before    string
+		after     string
+		found     bool
+	}{
+		{input: "A*B?*C*", separator: '*', release: '?', before: "A", after: "B?*C*", found: true},
+		{input: "B?*C*", separator: '*', release: '?', before: "B?*C", after: "", found: true},
+		{input: "A??*B", separator: '*', release: '?', before: "A??", after: "B", found: true},
+		{input: "A?*B", separator: '*', release: 0, before: "A?", after: "B", found: true},
+		{input: "A?*B", separator: '*', release: '?', before: "A?*B", found: false},
+		{input: "Köln¦Bonn", separator: '¦', release: 0, before: "Köln", after: "Bonn", found: true},
+	}
+	for _, tt := range tests {
+		before, after, found := cut([]byte(tt.input), tt.separator, tt.release)
+		assert.Equal(t, tt.before, string(before))
+		assert.Equal(t, tt.after, string(after))
+		assert.Equal(t, tt.found, found)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	assert.Equal(t, "A*B?C", string(unescape(nil, []byte("A?*B??C"), '?')))
+	assert.Equal(t, "A?*B", string(unescape(nil, []byte("A?*B"), 0)))
+	assert.Equal(t, "X:A*B", string(unescape([]byte("X:"), []byte("A?*B"), '?')))
+}
+
+func TestLexer_Next_Positions(t *testing.T) {
+	t.Run("ISA tokens are positioned", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		tokens, err := NewLexer(file).Tokens()
+		assert.NoError(t, err)
+		assert.Equal(t, Position{Offset: 0, Segment: 1, Element: 0, Line: 1}, tokens[0].Position)
+		assert.Equal(t, Position{Offset: 3, Segment: 1, Element: 1, Line: 1}, tokens[1].Position)
+		assert.Equal(t, Position{Offset: 4, Segment: 1, Element: 1, Line: 1}, tokens[2].Position)
+		assert.Equal(t, Position{Offset: 104, Segment: 1, Element: 16, Line: 1}, tokens[32].Position)
+		assert.Equal(t, Position{Offset: 105, Segment: 1, Element: 0, Line: 1}, tokens[33].Position)
+		assert.Equal(t, Position{Offset: 106, Segment: 2, Element: 0, Line: 1}, tokens[34].Position)
+	})
+
+	t.Run("Line numbers follow line feed terminators", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_new_line_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		lexer := NewLexer(file)
+		var last Token
+		for {
+			token, err := lexer.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			if token.Type == SegmentIdentifier {
+				assert.Equal(t, token.Position.Segment, token.Position.Line)
+			}
+			last = token
+		}
+		assert.Equal(t, 37, last.Position.Segment)
+		assert.Equal(t, int64(1077), last.Position.Offset)
+	})
+
+	t.Run("Positions continue across interchanges", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		tokens, err := NewLexer(file).Tokens()
+		assert.NoError(t, err)
+		var headers []Position
+		for _, token := range tokens {
+			if token.Type == SegmentIdentifier && token.Value == "ISA" {
+				headers = append(headers, token.Position)
+			}
+		}
+		assert.Equal(t, []Position{
+			{Offset: 0, Segment: 1, Element: 0, Line: 1},
+			{Offset: 225, Segment: 8, Element: 0, Line: 2},
+		}, headers)
+	})
+}
+
+func TestLexer_Next_SyntaxError(t *testing.T) {
+	t.Run("Invalid ISA length is positioned", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader("ISA*00*"))
+		_, err := lexer.Next()
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.ErrorIs(t, err, ErrInvalidISALength)
+		assert.Equal(t, Position{Offset: 0, Segment: 1, Line: 1}, syntaxErr.Position)
+		assert.Equal(t, "ISA", syntaxErr.SegmentID)
+		assert.Equal(t, "ISA*00*", syntaxErr.Snippet)
+	})
+
+	t.Run("Truncated ISA of a subsequent interchange is positioned", func(t *testing.T) {
+		input := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~IEA*1*000000000~ISA*00*"
+		_, err := NewLexer(strings.NewReader(input)).Tokens()
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.ErrorIs(t, err, ErrInvalidISALength)
+		assert.Equal(t, Position{Offset: 122, Segment: 3, Line: 1}, syntaxErr.Position)
+	})
+}
+
+func TestLexer_Next_ISADetection(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+
+	t.Run("Short reads are tolerated", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		tokens, err := NewLexer(iotest.HalfReader(iotest.OneByteReader(file))).Tokens()
+		assert.NoError(t, err)
+		assert.Len(t, tokens, 504)
+	})
+
+	t.Run("Invalid field widths are rejected", func(t *testing.T) {
+		input := "ISA*00*        *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~GS*PO~"
+		_, err := NewLexer(strings.NewReader(input)).Tokens()
+		assert.ErrorIs(t, err, ErrInvalidISA)
+	})
+
+	t.Run("Prefix is skipped and exposed", func(t *testing.T) {
+		prefix := "From: mailbox@van.example\r\nSubject: VISA ISA* batch\r\n\r\n"
+		lexer := NewLexer(strings.NewReader(prefix+isa+"GS*PO~"), WithSkipPrefix())
+		tokens, err := lexer.Tokens()
+		assert.NoError(t, err)
+		assert.Len(t, tokens, 38)
+		assert.Equal(t, prefix, string(lexer.Prefix()))
+		assert.Equal(t, Position{Offset: int64(len(prefix)), Segment: 1, Line: 4}, tokens[0].Position)
+	})
+
+	t.Run("Prefix is empty when input starts with ISA", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader(isa), WithSkipPrefix())
+		_, err := lexer.Tokens()
+		assert.NoError(t, err)
+		assert.Empty(t, lexer.Prefix())
+	})
+
+	t.Run("Missing ISA is reported", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader("no interchange here"), WithSkipPrefix())
+		_, err := lexer.Tokens()
+		assert.ErrorIs(t, err, ErrISANotFound)
+		assert.Equal(t, "no interchange here", string(lexer.Prefix()))
+	})
+}
+
+func TestLexer_Next_MultiByteDelimiters(t *testing.T) {
+	// The last byte of 'ö' matches the last byte of the '¶' terminator
+	input := "ISA¦00¦          ¦00¦          ¦ZZ¦SENDER         ¦ZZ¦RECEIVER       ¦190430¦1230¦U¦00401¦000000000¦0¦T¦»¶N1¦ST¦Köln»Zoë¶SE¦2¶"
+	parser := NewParser(strings.NewReader(input))
+	segments, err := parser.Segments()
+	assert.NoError(t, err)
+	assert.Equal(t, Delimiters{Segment: '¶', Element: '¦', SubElement: '»'}, parser.Delimiters())
+	assert.Len(t, segments, 3)
+	assert.Equal(t, Element{Value: "Köln", SubElements: []string{"Zoë"}}, segments[1].Elements[1])
+	assert.Equal(t, int64(len("ISA¦00¦          ¦00¦          ¦ZZ¦SENDER         ¦ZZ¦RECEIVER       ¦190430¦1230¦U¦00401¦000000000¦0¦T¦»¶")), segments[1].Position.Offset)
+	assert.Equal(t, "SE", segments[2].ID)
+	assert.Equal(t, input, segments.DString(parser.Delimiters()))
+}
+
+func TestLexer_Next_MultiByteRelease(t *testing.T) {
+	input := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~N1*Zoë¿*Köln¿¿~"
+	parser := NewParser(strings.NewReader(input), WithRelease('¿'))
+	segments, err := parser.Segments()
+	assert.NoError(t, err)
+	assert.Equal(t, Elements{{Value: "Zoë*Köln¿"}}, segments[1].Elements)
+}
+
+func TestLexer_TokensContext(t *testing.T) {
+	t.Run("Uncanceled context should succeed", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		tokens, err := NewLexer(file).TokensContext(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 504, len(tokens))
+	})
+	t.Run("Canceled context should fail", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		tokens, err := NewLexer(file).TokensContext(ctx)
+		assert.Empty(t, tokens)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// syntheticInput returns an interchange holding a single transaction set of n segments.
+func syntheticInput(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*^*00501*000000001*0*T*>~")
+	buf.WriteString("GS*PO*SENDER*RECEIVER*20190430*1230*1*X*005010~ST*850*0001~")
+	for i := 0; i < n; i++ {
+		buf.WriteString("PO1*1*10*EA*9.25*TE*IN*123456789*VN*ABC>DEF^GHI~")
+	}
+	fmt.Fprintf(&buf, "SE*%d*0001~GE*1*1~IEA*1*000000001~", n+2)
+	return buf.Bytes()
+}
+
+func BenchmarkLexer_Next(b *testing.B) {
+	inputs := map[string]string{
+		"850_long":         "./test/850_long.txt",
+		"850_tilde":        "./test/850_with_tilde_segment_terminator.txt",
+		"850_new_line":     "./test/850_with_new_line_segment_terminator.txt",
+		"850_bom_and_crlf": "./test/850_with_bom_and_crlf.txt",
+	}
+	for name, path := range inputs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			benchmarkLexer(b, data, WithWhitespace(TrimWhitespace))
+		})
+	}
+	b.Run("synthetic_1M_segments", func(b *testing.B) {
+		benchmarkLexer(b, syntheticInput(1000000))
+	})
+}
+
+func benchmarkLexer(b *testing.B, data []byte, opts ...Option) {
+	// The input is built by the caller, outside the timed region
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		lexer := NewLexer(bytes.NewReader(data), opts...)
+		for {
+			_, err := lexer.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestLexer_NextRaw(t *testing.T) {
+	t.Run("Values match those of Next", func(t *testing.T) {
+		data, err := os.ReadFile("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+
+		want, err := NewLexer(bytes.NewReader(data)).Tokens()
+		assert.NoError(t, err)
+
+		lexer := NewLexer(bytes.NewReader(data))
+		for _, token := range want {
+			raw, err := lexer.NextRaw()
+			assert.NoError(t, err)
+			assert.Equal(t, token, raw.Token())
+		}
+		_, err = lexer.NextRaw()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("Escaped values are unescaped", func(t *testing.T) {
+		isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+		lexer := NewLexer(strings.NewReader(isa+"N1*A?*B*C?~D~"), WithRelease('?'))
+		var values []string
+		for {
+			raw, err := lexer.NextRaw()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			if raw.Type == ElementValue && raw.Position.Segment == 2 {
+				values = append(values, string(raw.Value))
+			}
+		}
+		assert.Equal(t, []string{"A*B", "C~D"}, values)
+	})
+	t.Run("Cloned values outlive the segment", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader("N1*ST~N1*BT~"), WithDelimiters(DefaultDelimiters))
+		_, _ = lexer.NextRaw()
+		_, _ = lexer.NextRaw()
+		raw, err := lexer.NextRaw()
+		assert.NoError(t, err)
+		cloned := raw.Clone()
+
+		for i := 0; i < 3; i++ {
+			_, err = lexer.NextRaw()
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, RawToken{Type: ElementValue, Value: []byte("ST"), Position: Position{Offset: 3, Segment: 1, Element: 1, Line: 1}}, cloned)
+	})
+	t.Run("Buffers are reused between segments", func(t *testing.T) {
+		lexer := NewLexer(bytes.NewReader(syntheticInput(1000)))
+		for i := 0; i < 1000; i++ {
+			_, err := lexer.NextRaw()
+			assert.NoError(t, err)
+		}
+		allocs := testing.AllocsPerRun(1000, func() {
+			if _, err := lexer.NextRaw(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		assert.Zero(t, allocs)
+	})
+}
+
+func BenchmarkLexer_NextRaw(b *testing.B) {
+	data := syntheticInput(1000000)
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		lexer := NewLexer(bytes.NewReader(data))
+		for {
+			_, err := lexer.NextRaw()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package hedi
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrInputTooLarge is returned when the input exceeds the maximum number of bytes set WithMaxBytes.
+	ErrInputTooLarge = errors.New("input too large")
+	// ErrSegmentTooLong is returned when a segment exceeds the maximum length set WithMaxSegmentLength.
+	ErrSegmentTooLong = errors.New("segment too long")
+	// ErrTooManyElements is returned when a segment exceeds the maximum number of elements set WithMaxElements.
+	ErrTooManyElements = errors.New("too many elements")
+	// ErrTooManySubElements is returned when an element exceeds the maximum number of sub-elements set WithMaxSubElements.
+	ErrTooManySubElements = errors.New("too many sub-elements")
+	// ErrTooManySegments is returned when the input exceeds the maximum number of segments set WithMaxSegments.
+	ErrTooManySegments = errors.New("too many segments")
+)
+
+// limitReader reads at most max bytes from reader, and fails with ErrInputTooLarge if any input remains beyond that.
+type limitReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+// Read satisfies the io.Reader interface. Once the limit has been exceeded, every call returns ErrInputTooLarge.
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remaining <= 0 {
+		// Probe for input beyond the limit
+		var probe [1]byte
+		n, err := r.reader.Read(probe[:])
+		if n > 0 {
+			r.err = ErrInputTooLarge
+			return 0, r.err
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// checkLimits verifies the tokens of a single segment against the configured maximum numbers of
+// elements and sub-elements. Sub-elements are counted per element, or per repetition of an element.
+func checkLimits(tokens []RawToken, c config) error {
+	if c.maxElements <= 0 && c.maxSubElements <= 0 {
+		return nil
+	}
+
+	elements, subElements := 0, 0
+	for _, token := range tokens {
+		switch token.Type {
+		case ElementDelimiter:
+			elements++
+			subElements = 0
+			if c.maxElements > 0 && elements > c.maxElements {
+				return newSyntaxError(ErrTooManyElements, token.Position, string(tokens[0].Value), "")
+			}
+		case RepetitionDelimiter:
+			subElements = 0
+		case SubElementValue:
+			subElements++
+			if c.maxSubElements > 0 && subElements > c.maxSubElements {
+				return newSyntaxError(ErrTooManySubElements, token.Position, string(tokens[0].Value), string(token.Value))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package hedi
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLimits(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+
+	tests := []struct {
+		name    string
+		input   string
+		option  Option
+		wantErr error
+		wantPos Position
+	}{
+		{
+			name:   "Input within the maximum bytes",
+			input:  isa + "GS*PO~",
+			option: WithMaxBytes(int64(len(isa) + 6)),
+		},
+		{
+			name:    "Input exceeding the maximum bytes",
+			input:   isa + "GS*PO~ST*850~",
+			option:  WithMaxBytes(int64(len(isa) + 6)),
+			wantErr: ErrInputTooLarge,
+			wantPos: Position{Offset: 112, Segment: 3, Line: 1},
+		},
+		{
+			name:   "Segment within the maximum length",
+			input:  isa + "GS*PO~",
+			option: WithMaxSegmentLength(5),
+		},
+		{
+			name:    "Segment exceeding the maximum length",
+			input:   isa + "GS*PO~ST*850~",
+			option:  WithMaxSegmentLength(5),
+			wantErr: ErrSegmentTooLong,
+			wantPos: Position{Offset: 112, Segment: 3, Line: 1},
+		},
+		{
+			name:    "Unterminated segment exceeding the maximum length",
+			input:   isa + "GS*PO~ST*850",
+			option:  WithMaxSegmentLength(5),
+			wantErr: ErrSegmentTooLong,
+			wantPos: Position{Offset: 112, Segment: 3, Line: 1},
+		},
+		{
+			name:    "Segment exceeding the maximum length beyond the read buffer",
+			input:   isa + "GS*" + strings.Repeat("A", 10000) + "~",
+			option:  WithMaxSegmentLength(8192),
+			wantErr: ErrSegmentTooLong,
+			wantPos: Position{Offset: 106, Segment: 2, Line: 1},
+		},
+		{
+			name:   "Segment within the maximum elements",
+			input:  isa + "N1*ST*XYZ~",
+			option: WithMaxElements(2),
+		},
+		{
+			name:    "Segment exceeding the maximum elements",
+			input:   isa + "N1*ST*XYZ*92~",
+			option:  WithMaxElements(2),
+			wantErr: ErrTooManyElements,
+			wantPos: Position{Offset: 115, Segment: 2, Element: 3, Line: 1},
+		},
+		{
+			name:   "Element within the maximum sub-elements",
+			input:  strings.Replace(strings.Replace(isa, "00401", "00501", 1), "*U*", "*^*", 1) + "HI*ABK>I10^ABF>I11~",
+			option: WithMaxSubElements(1),
+		},
+		{
+			name:    "Element exceeding the maximum sub-elements",
+			input:   isa + "SV1*HC>99213>25~",
+			option:  WithMaxSubElements(1),
+			wantErr: ErrTooManySubElements,
+			wantPos: Position{Offset: 119, Segment: 2, Element: 1, Line: 1},
+		},
+		{
+			name:   "Input within the maximum segments",
+			input:  isa + "GS*PO~",
+			option: WithMaxSegments(2),
+		},
+		{
+			name:    "Input exceeding the maximum segments",
+			input:   isa + "GS*PO~ST*850~",
+			option:  WithMaxSegments(2),
+			wantErr: ErrTooManySegments,
+			wantPos: Position{Offset: 112, Segment: 3, Line: 1},
+		},
+		{
+			name:    "Interchange header exceeding the maximum segments",
+			input:   isa + "IEA*0*000000000~" + isa,
+			option:  WithMaxSegments(2),
+			wantErr: ErrTooManySegments,
+			wantPos: Position{Offset: 122, Segment: 3, Line: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewParser(strings.NewReader(tt.input), tt.option)
+			_, err := parser.Segments()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var syntaxErr *SyntaxError
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.True(t, errors.As(err, &syntaxErr))
+			assert.Equal(t, tt.wantPos, syntaxErr.Position)
+		})
+	}
+
+	t.Run("Segment exceeding the maximum length is quoted", func(t *testing.T) {
+		lexer := NewLexer(strings.NewReader(isa+"GS*PO~ST*850~"), WithMaxSegmentLength(5))
+		_, err := lexer.Tokens()
+
+		var syntaxErr *SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+		assert.Equal(t, "ST*850", syntaxErr.Snippet)
+	})
+
+	t.Run("Segments are unlimited by default", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(isa + "GS*" + strings.Repeat("A", 100000) + "~"))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments[1].Elements[0].Value, 100000)
+	})
+
+	t.Run("Reader errors are propagated", func(t *testing.T) {
+		errRead := errors.New("connection reset")
+		reader := io.MultiReader(strings.NewReader(isa+"GS*PO~ST*8"), iotest.ErrReader(errRead))
+		parser := NewParser(reader)
+		_, err := parser.Segments()
+		assert.ErrorIs(t, err, errRead)
+	})
+
+	t.Run("Reader errors are propagated while skipping a prefix", func(t *testing.T) {
+		errRead := errors.New("connection reset")
+		parser := NewParser(iotest.ErrReader(errRead), WithSkipPrefix())
+		_, err := parser.Segments()
+		assert.ErrorIs(t, err, errRead)
+	})
+}
+
+func TestLimitReader(t *testing.T) {
+	t.Run("Input within the limit is read in full", func(t *testing.T) {
+		data, err := io.ReadAll(&limitReader{reader: strings.NewReader("ISA*00"), remaining: 6})
+		assert.NoError(t, err)
+		assert.Equal(t, "ISA*00", string(data))
+	})
+	t.Run("Input beyond the limit fails", func(t *testing.T) {
+		reader := &limitReader{reader: strings.NewReader("ISA*00*"), remaining: 6}
+		data, err := io.ReadAll(reader)
+		assert.ErrorIs(t, err, ErrInputTooLarge)
+		assert.Equal(t, "ISA*00", string(data))
+
+		_, err = reader.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, ErrInputTooLarge)
+	})
+}
@@ -0,0 +1,300 @@
+package hedi
+
+import (
+	"runtime"
+	"time"
+)
+
+// Option configures the behaviour of a Lexer or Parser.
+type Option func(*config)
+
+// config holds the settings applied by Options.
+type config struct {
+	release    rune
+	whitespace WhitespacePolicy
+	unwrap     bool
+	skipPrefix bool
+	delimiters *Delimiters
+	charset    Charset
+	recovery   bool
+
+	maxBytes         int64
+	maxSegmentLength int
+	maxElements      int
+	maxSubElements   int
+	maxSegments      int
+}
+
+// newConfig returns a config with the given Options applied.
+func newConfig(opts []Option) config {
+	c := config{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithRelease sets the release character used to escape delimiters within values.
+// X12 interchanges do not declare a release character in the ISA segment, so the
+// character agreed with the trading partner must be supplied explicitly.
+func WithRelease(release rune) Option {
+	return func(c *config) {
+		c.release = release
+	}
+}
+
+// WithWhitespace sets the WhitespacePolicy of the Lexer. The default is PreserveWhitespace.
+func WithWhitespace(policy WhitespacePolicy) Option {
+	return func(c *config) {
+		c.whitespace = policy
+	}
+}
+
+// WithUnwrap enables detection of input that is hard-wrapped at a fixed line width regardless of
+// segment boundaries. When wrapping is detected, all line breaks are removed from the input before it is lexed,
+// and positions refer to the unwrapped input.
+func WithUnwrap() Option {
+	return func(c *config) {
+		c.unwrap = true
+	}
+}
+
+// WithSkipPrefix scans forward to the first valid ISA segment, skipping any preceding input
+// such as mail headers or VAN banners. The skipped input is available from the Lexer's Prefix.
+func WithSkipPrefix() Option {
+	return func(c *config) {
+		c.skipPrefix = true
+	}
+}
+
+// WithDelimiters supplies the delimiters of the input explicitly, allowing fragments without an
+// ISA segment, such as bare ST to SE transaction sets, to be lexed. Any ISA segment following an
+// IEA segment still has its delimiters detected.
+func WithDelimiters(delimiters Delimiters) Option {
+	return func(c *config) {
+		c.delimiters = &delimiters
+	}
+}
+
+// WithCharset restricts segment identifiers and element values to the given Charset, such as X12Basic or UNOA.
+// Values of the fixed-width ISA segment are not checked, as they include its delimiters.
+func WithCharset(charset Charset) Option {
+	return func(c *config) {
+		c.charset = charset
+	}
+}
+
+// WithRecovery enables the Parser's recovery mode, in which segment identifiers are also checked, and problems
+// are collected rather than aborting parsing. Segments with an invalid identifier and empty segments are skipped,
+// segments with sub-elements in their identifier are repaired, and values with invalid characters are kept.
+func WithRecovery() Option {
+	return func(c *config) {
+		c.recovery = true
+	}
+}
+
+// WithMaxBytes limits the input to n bytes, as read from the underlying reader. Reading beyond the limit fails
+// with ErrInputTooLarge.
+func WithMaxBytes(n int64) Option {
+	return func(c *config) {
+		c.maxBytes = n
+	}
+}
+
+// WithMaxSegmentLength limits each segment to n bytes, excluding its terminator. Longer segments fail with
+// ErrSegmentTooLong before they are read in full.
+func WithMaxSegmentLength(n int) Option {
+	return func(c *config) {
+		c.maxSegmentLength = n
+	}
+}
+
+// WithMaxElements limits each segment to n elements. Segments with more elements fail with ErrTooManyElements.
+// The fixed-width ISA segment is not checked.
+func WithMaxElements(n int) Option {
+	return func(c *config) {
+		c.maxElements = n
+	}
+}
+
+// WithMaxSubElements limits each element, and each repetition of an element, to n sub-elements following its value.
+// Elements with more sub-elements fail with ErrTooManySubElements.
+func WithMaxSubElements(n int) Option {
+	return func(c *config) {
+		c.maxSubElements = n
+	}
+}
+
+// WithMaxSegments limits the input to n segments, including those of any envelopes.
+// Further segments fail with ErrTooManySegments.
+func WithMaxSegments(n int) Option {
+	return func(c *config) {
+		c.maxSegments = n
+	}
+}
+
+// WriteOption configures how Segments are written.
+type WriteOption func(*writeConfig)
+
+// writeConfig holds the settings applied by WriteOptions.
+type writeConfig struct {
+	wrapWidth    int
+	wrapEnding   LineEnding
+	trimTrailing bool
+	normalize    bool
+}
+
+// newWriteConfig returns a writeConfig with the given WriteOptions applied.
+func newWriteConfig(opts []WriteOption) writeConfig {
+	c := writeConfig{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithWrap hard-wraps the output at width bytes per line, regardless of segment boundaries,
+// terminating every line, including the last, with the given line ending.
+func WithWrap(width int, ending LineEnding) WriteOption {
+	return func(c *writeConfig) {
+		c.wrapWidth = width
+		c.wrapEnding = ending
+	}
+}
+
+// WithTrimTrailing omits trailing empty elements from each segment, and trailing empty sub-elements and repetitions
+// from each element, as trailing delimiters are a syntax error in X12. The fixed-width ISA segment is not trimmed.
+func WithTrimTrailing() WriteOption {
+	return func(c *writeConfig) {
+		c.trimTrailing = true
+	}
+}
+
+// elements returns the Elements of segment to be written.
+func (c writeConfig) elements(segment Segment) Elements {
+	if !c.trimTrailing || segment.ID == "ISA" {
+		return segment.Elements
+	}
+	return segment.Elements.trimTrailing()
+}
+
+// WithNormalize recomputes the counts and control numbers of envelope trailers before writing, as for
+// Segments.Normalize, leaving the Segments written unchanged.
+func WithNormalize() WriteOption {
+	return func(c *writeConfig) {
+		c.normalize = true
+	}
+}
+
+// segments returns the Segments to be written.
+func (c writeConfig) segments(s Segments) Segments {
+	if !c.normalize {
+		return s
+	}
+	return s.normalized()
+}
+
+// BuildOption configures the envelopes built by an InterchangeBuilder.
+type BuildOption func(*buildConfig)
+
+// buildConfig holds the settings applied by BuildOptions.
+type buildConfig struct {
+	version                 string
+	usageIndicator          string
+	acknowledgmentRequested bool
+	date                    time.Time
+	controlNumbers          ControlNumberSource
+}
+
+// newBuildConfig returns a buildConfig with the given BuildOptions applied.
+// By default, envelopes are of version 005010 for production use, and numbered from 1.
+func newBuildConfig(opts []BuildOption) buildConfig {
+	c := buildConfig{version: defaultVersion, usageIndicator: UsageProduction}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.controlNumbers == nil {
+		c.controlNumbers = NewMemoryControlNumbers()
+	}
+	return c
+}
+
+// WithVersion sets the GS08 version, release and industry identifier code, such as "004010" or "005010X222A1".
+// The ISA12 interchange control version is its first five characters.
+func WithVersion(version string) BuildOption {
+	return func(c *buildConfig) {
+		c.version = version
+	}
+}
+
+// WithUsageIndicator sets the ISA15 usage indicator, one of UsageProduction, UsageTest or UsageInformation.
+func WithUsageIndicator(indicator string) BuildOption {
+	return func(c *buildConfig) {
+		c.usageIndicator = indicator
+	}
+}
+
+// WithAcknowledgmentRequested requests an interchange acknowledgment in ISA14.
+func WithAcknowledgmentRequested() BuildOption {
+	return func(c *buildConfig) {
+		c.acknowledgmentRequested = true
+	}
+}
+
+// WithDate sets the date and time of the ISA and GS segments, in place of the time of building.
+func WithDate(date time.Time) BuildOption {
+	return func(c *buildConfig) {
+		c.date = date
+	}
+}
+
+// WithControlNumbers draws control numbers from source.
+func WithControlNumbers(source ControlNumberSource) BuildOption {
+	return func(c *buildConfig) {
+		c.controlNumbers = source
+	}
+}
+
+// ParallelOption configures how a Parser parses input in parallel.
+type ParallelOption func(*parallelConfig)
+
+// parallelConfig holds the settings applied by ParallelOptions.
+type parallelConfig struct {
+	workers   int
+	unordered bool
+	split     Split
+}
+
+// newParallelConfig returns a parallelConfig with the given ParallelOptions applied.
+// By default, there are as many workers as usable CPUs.
+func newParallelConfig(opts []ParallelOption) parallelConfig {
+	c := parallelConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.workers < 1 {
+		c.workers = 1
+	}
+	return c
+}
+
+// WithWorkers sets the number of Parts parsed concurrently.
+func WithWorkers(n int) ParallelOption {
+	return func(c *parallelConfig) {
+		c.workers = n
+	}
+}
+
+// WithUnordered delivers Parts as soon as they are parsed, rather than in their original order.
+func WithUnordered() ParallelOption {
+	return func(c *parallelConfig) {
+		c.unordered = true
+	}
+}
+
+// WithSplit sets the boundaries at which the input is divided into Parts. The default is SplitTransactionSets.
+func WithSplit(split Split) ParallelOption {
+	return func(c *parallelConfig) {
+		c.split = split
+	}
+}
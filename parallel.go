@@ -0,0 +1,219 @@
+package hedi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// Split selects the boundaries at which input is divided into Parts for parsing in parallel.
+type Split int
+
+const (
+	// SplitTransactionSets divides the input at ST and SE segments.
+	SplitTransactionSets Split = iota
+	// SplitInterchanges divides the input at ISA and IEA segments.
+	SplitInterchanges
+)
+
+// bounds returns the identifiers of the segments starting and ending a Part.
+func (s Split) bounds() (start, end []byte) {
+	if s == SplitInterchanges {
+		return []byte("ISA"), []byte("IEA")
+	}
+	return []byte("ST"), []byte("SE")
+}
+
+// Part is a run of consecutive segments parsed in parallel: a transaction set or an interchange,
+// or the envelope segments between them.
+type Part struct {
+	// Index is the 0-based ordinal of the Part within the input.
+	Index int
+	// Delimiters are the delimiters in effect at the end of the Part.
+	Delimiters Delimiters
+	Segments   Segments
+	// Err is the error encountered while scanning or parsing the Part, if any.
+	Err error
+}
+
+// job is a Part of the input awaiting parsing, along with the Lexer resuming from the state at its start.
+type job struct {
+	index int
+	lexer *Lexer
+	err   error
+}
+
+// parse parses the job into a Part.
+func (j job) parse(ctx context.Context) Part {
+	if j.err != nil {
+		return Part{Index: j.index, Err: j.err}
+	}
+	parser := &Parser{lexer: j.lexer}
+	segments, err := parser.SegmentsContext(ctx)
+	return Part{Index: j.index, Delimiters: parser.Delimiters(), Segments: segments, Err: err}
+}
+
+// Parallel divides the input into Parts at the boundaries set WithSplit and parses them concurrently.
+// The input is scanned beforehand to find the boundaries, without lexing the segments in between.
+// Parts are delivered on the returned channel in their original order, unless WithUnordered is set,
+// and the channel is closed once the input has been fully consumed. Concatenated in order, the Segments of
+// the Parts are those returned by Segments.
+// Scanning stops at the first error, which is delivered in the last Part. The channel must be drained,
+// or ctx canceled, to release the goroutines involved; once ctx is canceled, delivery stops.
+func (p *Parser) Parallel(ctx context.Context, opts ...ParallelOption) <-chan Part {
+	config := newParallelConfig(opts)
+	jobs := make(chan job)
+	parsed := make(chan Part)
+	parts := make(chan Part)
+	// Bounds the number of Parts held in memory at once
+	slots := make(chan struct{}, 2*config.workers)
+
+	go func() {
+		defer close(jobs)
+		p.scan(ctx, config.split, jobs, slots)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < config.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				select {
+				case parsed <- j.parse(ctx):
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(parsed)
+	}()
+
+	go deliver(ctx, parsed, parts, slots, config.unordered)
+	return parts
+}
+
+// scan divides the input into jobs at the boundaries of split. Each job holds the input spanned by its segments,
+// recorded while scanning, and the input preceding a segment starting a Part, such as line breaks, is kept with it.
+func (p *Parser) scan(ctx context.Context, split Split, jobs chan<- job, slots chan struct{}) {
+	l := p.lexer
+	start, end := split.bounds()
+
+	index := 0
+	send := func(j job) bool {
+		j.index = index
+		index++
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		select {
+		case jobs <- j:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if !l.begun {
+		l.begun = true
+		if err := l.begin(); err != nil && err != io.EOF {
+			send(job{err: err})
+			return
+		}
+	}
+	l.recording = true
+	defer func() {
+		l.recording, l.record = false, nil
+	}()
+
+	// The state at the start of the current Part, and following its last segment
+	first, last := l.snapshot(), l.snapshot()
+	mark, segments := 0, 0
+	flush := func() bool {
+		input := l.record[:mark:mark]
+		l.record = append([]byte(nil), l.record[mark:]...)
+		j := job{lexer: first.resume(input, l.config)}
+		first, mark, segments = last, 0, 0
+		return send(j)
+	}
+
+	for i := 0; ; i++ {
+		if l.checkContext(ctx, i) != nil {
+			return
+		}
+
+		segment, n, err := l.scanNext()
+		if err == io.EOF {
+			if segments > 0 {
+				mark = len(l.record)
+				flush()
+			}
+			return
+		}
+		if err != nil {
+			if segments == 0 || flush() {
+				send(job{err: err})
+			}
+			return
+		}
+
+		id := []byte("ISA")
+		if len(l.pending) > 0 {
+			l.pending = l.pending[:0] // Consumed while scanning
+		} else {
+			id, _, _ = cut(segment, l.delimiters.Element, l.delimiters.Release)
+			id = trimLineBreaks(id) // Preserved before the segment unless trimming whitespace
+			l.position.Segment++
+			l.consume(segment, n)
+		}
+
+		if bytes.Equal(id, start) && segments > 0 && !flush() {
+			return
+		}
+		segments++
+		mark, last = len(l.record), l.snapshot()
+		if bytes.Equal(id, end) && !flush() {
+			return
+		}
+	}
+}
+
+// deliver passes parsed Parts on to parts, in their original order unless unordered, releasing a slot for each.
+func deliver(ctx context.Context, parsed <-chan Part, parts chan<- Part, slots <-chan struct{}, unordered bool) {
+	defer close(parts)
+
+	send := func(part Part) bool {
+		select {
+		case parts <- part:
+			<-slots
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	waiting := map[int]Part{}
+	next := 0
+	for part := range parsed {
+		if unordered {
+			if !send(part) {
+				return
+			}
+			continue
+		}
+
+		waiting[part.Index] = part
+		for part, ok := waiting[next]; ok; part, ok = waiting[next] {
+			delete(waiting, next)
+			next++
+			if !send(part) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package hedi
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// collect drains parts, returning them sorted by index.
+func collect(parts <-chan Part) []Part {
+	var collected []Part
+	for part := range parts {
+		collected = append(collected, part)
+	}
+	sort.Slice(collected, func(i, j int) bool {
+		return collected[i].Index < collected[j].Index
+	})
+	return collected
+}
+
+// partIDs returns the segment identifiers of each Part.
+func partIDs(parts []Part) [][]string {
+	var ids [][]string
+	for _, part := range parts {
+		var partIDs []string
+		for _, segment := range part.Segments {
+			partIDs = append(partIDs, segment.ID)
+		}
+		ids = append(ids, partIDs)
+	}
+	return ids
+}
+
+func TestParser_Parallel(t *testing.T) {
+	fixtures := []struct {
+		name string
+		path string
+		opts []Option
+	}{
+		{name: "Tilde as segment terminator", path: "./test/850_with_tilde_segment_terminator.txt"},
+		{name: "Line feed as segment terminator", path: "./test/850_with_new_line_segment_terminator.txt"},
+		{name: "Long purchase order", path: "./test/850_long.txt"},
+		{name: "Multiple interchanges", path: "./test/multiple_interchanges.txt"},
+		{name: "Multiple interchanges with CRLF", path: "./test/multiple_interchanges_crlf.txt"},
+		{name: "Byte order mark and CRLF", path: "./test/850_with_bom_and_crlf.txt", opts: []Option{WithWhitespace(TrimWhitespace)}},
+		{name: "Line-wrapped", path: "./test/850_wrapped_at_80.txt", opts: []Option{WithUnwrap()}},
+	}
+
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture.path)
+		assert.NoError(t, err)
+
+		want, err := NewParser(bytes.NewReader(data), fixture.opts...).Segments()
+		assert.NoError(t, err)
+
+		for _, split := range []Split{SplitTransactionSets, SplitInterchanges} {
+			for _, unordered := range []bool{false, true} {
+				opts := []ParallelOption{WithWorkers(3), WithSplit(split)}
+				if unordered {
+					opts = append(opts, WithUnordered())
+				}
+
+				t.Run(fixture.name, func(t *testing.T) {
+					parser := NewParser(bytes.NewReader(data), fixture.opts...)
+					got := Segments{}
+					for _, part := range collect(parser.Parallel(context.Background(), opts...)) {
+						assert.NoError(t, part.Err)
+						got = append(got, part.Segments...)
+					}
+					assert.Equal(t, want, got)
+				})
+			}
+		}
+	}
+
+	t.Run("Transaction sets are parsed separately", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parts := collect(NewParser(file).Parallel(context.Background()))
+		assert.Equal(t, [][]string{
+			{"ISA", "GS"},
+			{"ST", "BEG", "SE"},
+			{"GE", "IEA", "ISA", "GS"},
+			{"ST", "BIG", "SE"},
+			{"GE", "IEA"},
+		}, partIDs(parts))
+		assert.Equal(t, '*', parts[1].Delimiters.Element)
+		assert.Equal(t, '|', parts[3].Delimiters.Element)
+	})
+
+	t.Run("Interchanges are parsed separately", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parts := collect(NewParser(file).Parallel(context.Background(), WithSplit(SplitInterchanges)))
+		assert.Equal(t, [][]string{
+			{"ISA", "GS", "ST", "BEG", "SE", "GE", "IEA"},
+			{"ISA", "GS", "ST", "BIG", "SE", "GE", "IEA"},
+		}, partIDs(parts))
+	})
+
+	t.Run("Line breaks preserved before segments do not hide boundaries", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges_crlf.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parts := collect(NewParser(file).Parallel(context.Background()))
+		assert.Equal(t, [][]string{
+			{"ISA", "\r\nGS"},
+			{"\r\nST", "\r\nBEG", "\r\nSE"},
+			{"\r\nGE", "\r\nIEA", "ISA", "\r\nGS"},
+			{"\r\nST", "\r\nBIG", "\r\nSE"},
+			{"\r\nGE", "\r\nIEA"},
+		}, partIDs(parts))
+		assert.Equal(t, '|', parts[3].Delimiters.Element)
+	})
+
+	t.Run("Parts are delivered in order", func(t *testing.T) {
+		parser := NewParser(bytes.NewReader(syntheticInput(100)))
+		var indexes []int
+		for part := range parser.Parallel(context.Background(), WithWorkers(4), WithSplit(SplitInterchanges)) {
+			indexes = append(indexes, part.Index)
+		}
+		assert.Equal(t, []int{0}, indexes)
+
+		input := strings.Repeat("ST*850*0001~BEG*00*SA*PO1**20190430~SE*3*0001~", 50)
+		parser = NewParser(strings.NewReader(input), WithDelimiters(DefaultDelimiters))
+		indexes = nil
+		for part := range parser.Parallel(context.Background(), WithWorkers(4)) {
+			indexes = append(indexes, part.Index)
+			assert.Len(t, part.Segments, 3)
+			assert.Equal(t, 3*part.Index+1, part.Segments[0].Position.Segment)
+		}
+		assert.Len(t, indexes, 50)
+		assert.True(t, sort.IntsAreSorted(indexes))
+	})
+
+	t.Run("Parse errors are confined to their part", func(t *testing.T) {
+		input := "ST*850*0001~N1*ST*A*B~SE*3*0001~ST*850*0002~SE*2*0002~"
+		parser := NewParser(strings.NewReader(input), WithDelimiters(DefaultDelimiters), WithMaxElements(2))
+		parts := collect(parser.Parallel(context.Background()))
+
+		assert.Len(t, parts, 2)
+		assert.ErrorIs(t, parts[0].Err, ErrTooManyElements)
+		assert.NoError(t, parts[1].Err)
+		assert.Len(t, parts[1].Segments, 2)
+	})
+
+	t.Run("Scan errors end the input", func(t *testing.T) {
+		isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+		parser := NewParser(strings.NewReader(isa + "GS*PO~ST*850~SE*2~GE*1~IEA*1*000000000~ISA*00*"))
+		parts := collect(parser.Parallel(context.Background()))
+
+		assert.Len(t, parts, 4)
+		assert.Equal(t, []string{"GE", "IEA"}, partIDs(parts[2:3])[0])
+		assert.ErrorIs(t, parts[3].Err, ErrInvalidISALength)
+	})
+
+	t.Run("Canceled context stops delivery", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		parser := NewParser(bytes.NewReader(syntheticInput(1000)))
+		for part := range parser.Parallel(ctx) {
+			assert.Error(t, part.Err)
+		}
+	})
+}
+
+func BenchmarkParser_Parallel(b *testing.B) {
+	// One million segments in transaction sets of 100
+	var buf bytes.Buffer
+	buf.WriteString("ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*^*00501*000000001*0*T*>~")
+	buf.WriteString("GS*PO*SENDER*RECEIVER*20190430*1230*1*X*005010~")
+	for i := 0; i < 10000; i++ {
+		buf.WriteString("ST*850*0001~")
+		buf.WriteString(strings.Repeat("PO1*1*10*EA*9.25*TE*IN*123456789*VN*ABC>DEF^GHI~", 98))
+		buf.WriteString("SE*100*0001~")
+	}
+	buf.WriteString("GE*10000*1~IEA*1*000000001~")
+	data := buf.Bytes()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		for part := range NewParser(bytes.NewReader(data)).Parallel(context.Background()) {
+			if part.Err != nil {
+				b.Fatal(part.Err)
+			}
+		}
+	}
+}
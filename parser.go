@@ -1,8 +1,10 @@
 package hedi
 
 import (
+	"context"
 	"errors"
 	"io"
+	"strings"
 )
 
 var (
@@ -10,50 +12,258 @@ var (
 	ErrSegmentIdentifierExpected = errors.New("segment identifier expected")
 	// ErrElementExpected is returned when an element is expected but not found.
 	ErrElementExpected = errors.New("element expected")
+	// ErrEmptySegment is returned when a segment has neither an identifier nor elements.
+	ErrEmptySegment = errors.New("empty segment")
+	// ErrInvalidSegmentID is returned when a segment identifier is not two or three upper case letters or digits.
+	ErrInvalidSegmentID = errors.New("invalid segment identifier")
+	// ErrUnexpectedSubElement is returned when a segment identifier contains sub-elements or repetitions.
+	ErrUnexpectedSubElement = errors.New("unexpected sub-element")
 )
 
 // Parser encapsulates the parsing logic for EDI files.
 type Parser struct {
-	reader io.Reader
+	lexer  *Lexer
+	errors ErrorList
 }
 
-// NewParser creates a new Parser instance with the given io.Reader.
-func NewParser(reader io.Reader) *Parser {
+// NewParser creates a new Parser instance with the given io.Reader and optional Options.
+func NewParser(reader io.Reader, opts ...Option) *Parser {
 	return &Parser{
-		reader: reader,
+		lexer: NewLexer(reader, opts...),
 	}
 }
 
-// Segments reads from the underlying reader and converts the token stream into Segments.
-// It returns an error if the token stream does not conform to the expected structure.
-func (p *Parser) Segments() (Segments, error) {
-	lexer := NewLexer(p.reader)
-	tokens, err := lexer.Tokens()
-	if err != nil {
-		return nil, err
+// Next reads the next Segment from the underlying reader.
+// It returns io.EOF once the input has been fully consumed, and a *SyntaxError if the
+// token stream does not conform to the expected structure.
+// In recovery mode, segment identifiers are also checked, and problems are recorded in Errors and the
+// offending segment is repaired or skipped; an error is only returned if the input cannot be read any further.
+func (p *Parser) Next() (Segment, error) {
+	for {
+		segment, err := p.next()
+		if err == nil && p.lexer.config.recovery {
+			err = checkSegment(&segment, p.lexer.Delimiters())
+		}
+		if err == nil || err == io.EOF || !p.lexer.config.recovery {
+			return segment, err
+		}
+
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			return Segment{}, err
+		}
+		p.errors = append(p.errors, syntaxErr)
+
+		switch {
+		case errors.Is(err, ErrUnexpectedSubElement):
+			return segment, nil // Repaired
+		case errors.Is(err, ErrEmptySegment), errors.Is(err, ErrInvalidSegmentID):
+			continue // Skipped
+		case errors.Is(err, ErrInvalidCharacter):
+			continue // The lexer yields the offending segment next
+		default:
+			return Segment{}, err
+		}
 	}
-	segments := Segments{}
-	for _, token := range tokens {
+}
+
+// Errors returns the problems recorded while parsing in recovery mode.
+func (p *Parser) Errors() ErrorList {
+	return p.errors
+}
+
+// next builds the next Segment from the token stream.
+func (p *Parser) next() (Segment, error) {
+	var segment *Segment
+	for {
+		token, err := p.lexer.Next()
+		if err != nil {
+			return Segment{}, err
+		}
 		switch token.Type {
 		case SegmentIdentifier:
-			segments = append(segments, *NewSegment(token.Value))
+			segment = NewSegment(token.Value)
+			segment.Position = token.Position
 		case ElementValue:
-			lastSegment, ok := segments.Last()
-			if !ok {
-				return nil, ErrSegmentIdentifierExpected
+			if segment == nil {
+				return Segment{}, newSyntaxError(ErrSegmentIdentifierExpected, token.Position, "", token.Value)
 			}
-			lastSegment.AddElement(Element{Value: token.Value})
+			segment.AddElement(Element{Value: token.Value})
 		case SubElementValue:
-			lastSegment, ok := segments.Last()
-			if !ok {
-				return nil, ErrSegmentIdentifierExpected
+			if segment == nil {
+				return Segment{}, newSyntaxError(ErrSegmentIdentifierExpected, token.Position, "", token.Value)
 			}
-			lastElement, ok := lastSegment.Elements.Last()
+			lastElement, ok := segment.Elements.Last()
 			if !ok {
-				return nil, ErrElementExpected
+				return Segment{}, newSyntaxError(ErrElementExpected, token.Position, segment.ID, token.Value)
+			}
+			// Sub-elements following a repetition belong to that repetition
+			if lastRepetition, ok := lastElement.Repetitions.Last(); ok {
+				lastElement = lastRepetition
 			}
 			lastElement.AddSubElement(token.Value)
+		case RepetitionValue:
+			if segment == nil {
+				return Segment{}, newSyntaxError(ErrSegmentIdentifierExpected, token.Position, "", token.Value)
+			}
+			lastElement, ok := segment.Elements.Last()
+			if !ok {
+				return Segment{}, newSyntaxError(ErrElementExpected, token.Position, segment.ID, token.Value)
+			}
+			lastElement.AddRepetition(token.Value)
+		case SegmentTerminator:
+			if segment == nil {
+				return Segment{}, newSyntaxError(ErrSegmentIdentifierExpected, token.Position, "", token.Value)
+			}
+			// Elements without a value are omitted, as marked by their delimiters alone
+			segment.Elements.omit()
+			return *segment, nil
+		}
+	}
+}
+
+// NextInterchange reads the segments of the next interchange, up to and including its IEA segment,
+// from the underlying reader. The returned Interchange carries the delimiters identified in its ISA segment
+// and, as far as it is complete, its envelope hierarchy. It returns io.EOF once the input has been fully consumed.
+func (p *Parser) NextInterchange() (Interchange, error) {
+	return p.nextInterchange(context.Background())
+}
+
+// nextInterchange reads the segments of the next interchange, checking periodically whether ctx is done.
+func (p *Parser) nextInterchange(ctx context.Context) (Interchange, error) {
+	interchange := Interchange{}
+	for i := 0; ; i++ {
+		if err := p.lexer.checkContext(ctx, i); err != nil {
+			return Interchange{}, err
+		}
+		segment, err := p.Next()
+		if err == io.EOF && len(interchange.Segments) > 0 {
+			return interchange.withEnvelopes(), nil
+		}
+		if err != nil {
+			return Interchange{}, err
+		}
+		if len(interchange.Segments) == 0 {
+			interchange.Delimiters = p.lexer.Delimiters()
+		}
+		interchange.Segments = append(interchange.Segments, segment)
+		if strings.TrimLeft(segment.ID, "\r\n") == "IEA" {
+			return interchange.withEnvelopes(), nil
 		}
 	}
+}
+
+// Interchanges reads from the underlying reader and splits the input into its interchanges,
+// delegating to InterchangesContext.
+// It returns an error if the token stream does not conform to the expected structure.
+func (p *Parser) Interchanges() ([]Interchange, error) {
+	return p.InterchangesContext(context.Background())
+}
+
+// InterchangesContext reads from the underlying reader and splits the input into its interchanges,
+// checking periodically whether ctx is done. If so, it stops and returns a *ContextError wrapping
+// ctx.Err() with the position reached.
+func (p *Parser) InterchangesContext(ctx context.Context) ([]Interchange, error) {
+	var interchanges []Interchange
+	for {
+		interchange, err := p.nextInterchange(ctx)
+		if err == io.EOF {
+			return interchanges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		interchanges = append(interchanges, interchange)
+	}
+}
+
+// Delimiters returns the delimiters of the interchange currently being parsed.
+func (p *Parser) Delimiters() Delimiters {
+	return p.lexer.Delimiters()
+}
+
+// LineEnding returns the line break style separating segments, as detected following the first ISA segment.
+func (p *Parser) LineEnding() LineEnding {
+	return p.lexer.LineEnding()
+}
+
+// WrapWidth returns the line width at which the input was detected to be hard-wrapped,
+// or 0 if unwrapping is disabled or the input is not wrapped.
+func (p *Parser) WrapWidth() int {
+	return p.lexer.WrapWidth()
+}
+
+// Prefix returns the input skipped before the first ISA segment when WithSkipPrefix is enabled.
+func (p *Parser) Prefix() []byte {
+	return p.lexer.Prefix()
+}
+
+// Segments reads from the underlying reader and converts the token stream into Segments, delegating to SegmentsContext.
+// It returns an error if the token stream does not conform to the expected structure.
+// In recovery mode, the best-effort Segments are returned along with an ErrorList of all problems found.
+func (p *Parser) Segments() (Segments, error) {
+	return p.SegmentsContext(context.Background())
+}
+
+// SegmentsContext reads from the underlying reader and converts the token stream into Segments,
+// checking periodically whether ctx is done. If so, it stops and returns a *ContextError wrapping
+// ctx.Err() with the position reached, even in recovery mode.
+func (p *Parser) SegmentsContext(ctx context.Context) (Segments, error) {
+	segments := Segments{}
+	for i := 0; ; i++ {
+		if err := p.lexer.checkContext(ctx, i); err != nil {
+			return nil, err
+		}
+		segment, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && p.lexer.config.recovery {
+			break // Recorded in the ErrorList
+		}
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+	if len(p.errors) > 0 {
+		return segments, p.errors
+	}
 	return segments, nil
 }
+
+// checkSegment validates the identifier of a parsed segment. Sub-elements or repetitions in the identifier
+// are removed, but still reported as an ErrUnexpectedSubElement.
+func checkSegment(segment *Segment, delimiters Delimiters) error {
+	if segment.ID == "" && len(segment.Elements) == 0 {
+		return newSyntaxError(ErrEmptySegment, segment.Position, "", "")
+	}
+
+	if i := strings.IndexFunc(segment.ID, func(r rune) bool {
+		return r == delimiters.SubElement || (r == delimiters.Repetition && r != 0)
+	}); i >= 0 {
+		id := segment.ID
+		segment.ID = id[:i]
+		if validSegmentID(segment.ID) {
+			return newSyntaxError(ErrUnexpectedSubElement, segment.Position, segment.ID, id)
+		}
+	}
+
+	if !validSegmentID(segment.ID) {
+		return newSyntaxError(ErrInvalidSegmentID, segment.Position, segment.ID, segment.ID)
+	}
+	return nil
+}
+
+// validSegmentID reports whether id consists of an upper case letter followed by one or two upper case letters or digits.
+func validSegmentID(id string) bool {
+	if len(id) < 2 || len(id) > 3 || !isUpper(rune(id[0])) {
+		return false
+	}
+	for _, r := range id[1:] {
+		if !isUpper(r) && !isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
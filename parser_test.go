@@ -1,10 +1,15 @@
 package hedi
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseSegments(t *testing.T) {
@@ -40,4 +45,404 @@ func TestParser_Segments(t *testing.T) {
 		_, err := parser.Segments()
 		assert.Error(t, err)
 	})
+
+	t.Run("Error is a positioned SyntaxError", func(t *testing.T) {
+		reader := strings.NewReader("ISA*00*          *00*")
+		parser := NewParser(reader)
+		_, err := parser.Segments()
+
+		var syntaxErr *SyntaxError
+		assert.ErrorAs(t, err, &syntaxErr)
+		assert.ErrorIs(t, err, ErrInvalidISALength)
+		assert.Equal(t, 1, syntaxErr.Position.Segment)
+	})
+}
+
+func TestParser_Next(t *testing.T) {
+	t.Run("Yields segments one at a time until EOF", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parser := NewParser(file)
+		var ids []string
+		for {
+			segment, err := parser.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			ids = append(ids, segment.ID)
+		}
+		assert.Len(t, ids, 37)
+		assert.Equal(t, "ISA", ids[0])
+		assert.Equal(t, "IEA", ids[len(ids)-1])
+	})
+
+	t.Run("Builds elements and sub-elements", func(t *testing.T) {
+		reader := strings.NewReader("ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~N1*ST**9>1~")
+		parser := NewParser(reader)
+		_, err := parser.Next()
+		assert.NoError(t, err)
+
+		segment, err := parser.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, "N1", segment.ID)
+		assert.Equal(t, Elements{{Value: "ST"}, {Omitted: true}, {Value: "9", SubElements: []string{"1"}}}, segment.Elements)
+
+		_, err = parser.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestParser_Interchanges(t *testing.T) {
+	t.Run("Splits concatenated interchanges with their own delimiters", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parser := NewParser(file)
+		interchanges, err := parser.Interchanges()
+		assert.NoError(t, err)
+		assert.Len(t, interchanges, 2)
+
+		assert.Equal(t, Delimiters{Segment: '~', Element: '*', SubElement: '>'}, interchanges[0].Delimiters)
+		assert.Len(t, interchanges[0].Segments, 7)
+		assert.Equal(t, Element{Value: "PO1", SubElements: []string{"A"}}, interchanges[0].Segments[3].Elements[2])
+
+		assert.Equal(t, Delimiters{Segment: '\n', Element: '|', SubElement: ':'}, interchanges[1].Delimiters)
+		assert.Len(t, interchanges[1].Segments, 7)
+		assert.Equal(t, "ISA", interchanges[1].Segments[0].ID)
+		assert.Equal(t, "IEA", interchanges[1].Segments[6].ID)
+		assert.Equal(t, Element{Value: "INV1", SubElements: []string{"A"}}, interchanges[1].Segments[3].Elements[1])
+
+		for _, interchange := range interchanges {
+			assert.Equal(t, interchange.Segments[0], interchange.Header)
+			assert.Len(t, interchange.FunctionalGroups, 1)
+			assert.Equal(t, interchange.Segments[3:4], interchange.FunctionalGroups[0].TransactionSets[0].Segments)
+			assert.Equal(t, interchange.Segments[6], *interchange.Trailer)
+		}
+	})
+
+	t.Run("Splits interchanges separated by line breaks while preserving whitespace", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges_crlf.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		interchanges, err := NewParser(file).Interchanges()
+		assert.NoError(t, err)
+		assert.Len(t, interchanges, 2)
+
+		assert.Equal(t, Delimiters{Segment: '~', Element: '*', SubElement: '>'}, interchanges[0].Delimiters)
+		assert.Equal(t, Delimiters{Segment: '~', Element: '|', SubElement: ':'}, interchanges[1].Delimiters)
+		assert.Equal(t, "ISA", interchanges[1].Segments[0].ID)
+		assert.Equal(t, "\r\nGS", interchanges[1].Segments[1].ID)
+		assert.Equal(t, Element{Value: "INV1", SubElements: []string{"A"}}, interchanges[1].Segments[3].Elements[1])
+	})
+
+	t.Run("Returns an interchange without a trailer at EOF", func(t *testing.T) {
+		reader := strings.NewReader("ISA*00*          *00*          *ZZ*EMEDNYBAT      *ZZ*ETIN           *030219*1140*^*00501*006097493*0*T*:~GS*HC~")
+		parser := NewParser(reader)
+		interchanges, err := parser.Interchanges()
+		assert.NoError(t, err)
+		assert.Len(t, interchanges, 1)
+		assert.Len(t, interchanges[0].Segments, 2)
+		assert.Equal(t, "GS", interchanges[0].FunctionalGroups[0].Header.ID)
+		assert.Nil(t, interchanges[0].FunctionalGroups[0].Trailer)
+		assert.Nil(t, interchanges[0].Trailer)
+	})
+}
+
+func TestParser_Segments_MultipleInterchanges(t *testing.T) {
+	file, err := os.Open("./test/multiple_interchanges.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	parser := NewParser(file)
+	segments, err := parser.Segments()
+	assert.NoError(t, err)
+	assert.Len(t, segments, 14)
+	assert.Equal(t, "ISA", segments[7].ID)
+}
+
+func TestParser_Next_Repetitions(t *testing.T) {
+	input := "ISA*00*          *00*          *ZZ*EMEDNYBAT      *ZZ*ETIN           *030219*1140*^*00501*006097493*0*T*:~HI*ABK:I10^ABF:I11^ABF~"
+	parser := NewParser(strings.NewReader(input))
+	isa, err := parser.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "^", isa.Elements[10].Value)
+
+	segment, err := parser.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, Elements{{
+		Value:       "ABK",
+		SubElements: []string{"I10"},
+		Repetitions: Elements{
+			{Value: "ABF", SubElements: []string{"I11"}},
+			{Value: "ABF"},
+		},
+	}}, segment.Elements)
+	assert.Equal(t, "HI*ABK:I10^ABF:I11^ABF~", segment.DString(parser.Delimiters()))
+}
+
+func TestParser_Segments_Release(t *testing.T) {
+	input := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~N1*ST*A?*B?~C~"
+	parser := NewParser(strings.NewReader(input), WithRelease('?'))
+	segments, err := parser.Segments()
+	assert.NoError(t, err)
+	assert.Len(t, segments, 2)
+	assert.Equal(t, "A*B~C", segments[1].Elements[1].Value)
+	assert.Equal(t, input, segments.DString(parser.Delimiters()))
+}
+
+func TestParser_Next_Positions(t *testing.T) {
+	file, err := os.Open("./test/850_with_new_line_segment_terminator.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	parser := NewParser(file)
+	segments, err := parser.Segments()
+	assert.NoError(t, err)
+	assert.Equal(t, Position{Offset: 0, Segment: 1, Line: 1}, segments[0].Position)
+	assert.Equal(t, Position{Offset: 106, Segment: 2, Line: 2}, segments[1].Position)
+	assert.Equal(t, "PO1", segments[14].ID)
+	assert.Equal(t, 15, segments[14].Position.Segment)
+	assert.Equal(t, 15, segments[14].Position.Line)
+}
+
+func TestParser_Segments_WithDelimiters(t *testing.T) {
+	t.Run("Parses a headerless transaction set", func(t *testing.T) {
+		reader := strings.NewReader("ST*850*0001~BEG*00*SA*PO1>A~SE*3*0001~")
+		parser := NewParser(reader, WithDelimiters(DefaultDelimiters))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 3)
+		assert.Equal(t, "ST", segments[0].ID)
+		assert.Equal(t, Position{Offset: 0, Segment: 1, Line: 1}, segments[0].Position)
+		assert.Equal(t, Element{Value: "PO1", SubElements: []string{"A"}}, segments[1].Elements[2])
+		assert.Equal(t, DefaultDelimiters, parser.Delimiters())
+	})
+
+	t.Run("Repetitions are only split with a repetition separator", func(t *testing.T) {
+		input := "ST*850*0001~N1*ST*A^B~SE*3*0001~"
+		segments, err := NewParser(strings.NewReader(input), WithDelimiters(DefaultDelimiters)).Segments()
+		assert.NoError(t, err)
+		assert.Equal(t, Element{Value: "A^B"}, segments[1].Elements[1])
+
+		segments, err = NewParser(strings.NewReader(input), WithDelimiters(DefaultDelimiters5010)).Segments()
+		assert.NoError(t, err)
+		assert.Equal(t, Element{Value: "A", Repetitions: Elements{{Value: "B"}}}, segments[1].Elements[1])
+	})
+
+	t.Run("Uses the supplied delimiters", func(t *testing.T) {
+		delimiters := Delimiters{Segment: '\'', Element: '+', SubElement: ':', Release: '?'}
+		reader := strings.NewReader("\r\nUNH+1+ORDERS:D:96A:UN'FTX+AAA+++50?+ units'\r\n")
+		parser := NewParser(reader, WithDelimiters(delimiters), WithWhitespace(TrimWhitespace))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 2)
+		assert.Equal(t, Element{Value: "ORDERS", SubElements: []string{"D", "96A", "UN"}}, segments[0].Elements[1])
+		assert.Equal(t, "50+ units", segments[1].Elements[3].Value)
+	})
+
+	t.Run("Empty fragment has no segments", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(""), WithDelimiters(DefaultDelimiters))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Empty(t, segments)
+	})
+}
+
+func TestParser_Segments_Recovery(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+	input := isa + "GS*PO~~N1>X*ST~n1*bad~N2*Köln~ST*850~"
+
+	t.Run("Default mode leaves segment identifiers unchecked", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(input))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 7)
+		assert.Equal(t, "", segments[2].ID)
+		assert.Equal(t, "N1>X", segments[3].ID)
+		assert.Equal(t, "n1", segments[4].ID)
+	})
+
+	t.Run("Recovery mode collects all problems", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(input), WithRecovery())
+		segments, err := parser.Segments()
+
+		var list ErrorList
+		assert.True(t, errors.As(err, &list))
+		assert.Len(t, list, 3)
+		assert.ErrorIs(t, list[0], ErrEmptySegment)
+		assert.Equal(t, 3, list[0].Position.Segment)
+		assert.ErrorIs(t, list[1], ErrUnexpectedSubElement)
+		assert.Equal(t, "N1", list[1].SegmentID)
+		assert.ErrorIs(t, list[2], ErrInvalidSegmentID)
+		assert.Equal(t, 5, list[2].Position.Segment)
+		assert.Equal(t, list, parser.Errors())
+
+		var ids []string
+		for _, segment := range segments {
+			ids = append(ids, segment.ID)
+		}
+		assert.Equal(t, []string{"ISA", "GS", "N1", "N2", "ST"}, ids)
+		assert.Equal(t, Elements{{Value: "ST"}}, segments[2].Elements)
+		assert.Equal(t, "Köln", segments[3].Elements[0].Value)
+	})
+
+	t.Run("Recovery mode keeps values with invalid characters", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(isa+"N2*Köln~"), WithRecovery(), WithCharset(X12Basic))
+		segments, err := parser.Segments()
+
+		var list ErrorList
+		assert.True(t, errors.As(err, &list))
+		assert.Len(t, list, 1)
+		assert.ErrorIs(t, list[0], ErrInvalidCharacter)
+		assert.Len(t, segments, 2)
+		assert.Equal(t, "Köln", segments[1].Elements[0].Value)
+	})
+
+	t.Run("Recovery mode returns best-effort segments on fatal errors", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(isa+"~IEA*1*000000000~ISA*00*"), WithRecovery())
+		segments, err := parser.Segments()
+
+		var list ErrorList
+		assert.True(t, errors.As(err, &list))
+		assert.Len(t, list, 2)
+		assert.ErrorIs(t, list[0], ErrEmptySegment)
+		assert.ErrorIs(t, list[1], ErrInvalidISALength)
+		assert.Len(t, segments, 2)
+	})
+
+	t.Run("Recovery mode without problems returns no error", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(isa+"GS*PO~"), WithRecovery())
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 2)
+		assert.Empty(t, parser.Errors())
+	})
+}
+
+func TestCheckSegment(t *testing.T) {
+	tests := []struct {
+		name    string
+		segment Segment
+		wantID  string
+		wantErr error
+	}{
+		{name: "Valid identifier", segment: Segment{ID: "PO1"}, wantID: "PO1"},
+		{name: "Empty segment", segment: Segment{}, wantErr: ErrEmptySegment},
+		{name: "Missing identifier", segment: Segment{Elements: Elements{{Value: "A"}}}, wantErr: ErrInvalidSegmentID},
+		{name: "Lower case identifier", segment: Segment{ID: "po1"}, wantID: "po1", wantErr: ErrInvalidSegmentID},
+		{name: "Long identifier", segment: Segment{ID: "PO12"}, wantID: "PO12", wantErr: ErrInvalidSegmentID},
+		{name: "Leading digit", segment: Segment{ID: "1PO"}, wantID: "1PO", wantErr: ErrInvalidSegmentID},
+		{name: "Sub-element in identifier", segment: Segment{ID: "PO1>2"}, wantID: "PO1", wantErr: ErrUnexpectedSubElement},
+		{name: "Repetition in identifier", segment: Segment{ID: "HI^X"}, wantID: "HI", wantErr: ErrUnexpectedSubElement},
+	}
+
+	delimiters := Delimiters{Segment: '~', Element: '*', SubElement: '>', Repetition: '^'}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment := tt.segment
+			err := checkSegment(&segment, delimiters)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantID, segment.ID)
+		})
+	}
+}
+
+func TestParser_SegmentsContext(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+	input := isa + strings.Repeat("N1*ST*XYZ~", 200)
+
+	t.Run("Uncanceled context should succeed", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(input))
+		segments, err := parser.SegmentsContext(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, segments, 201)
+	})
+
+	t.Run("Canceled context should stop before reading", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		parser := NewParser(strings.NewReader(input))
+		segments, err := parser.SegmentsContext(ctx)
+		assert.Nil(t, segments)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		var contextErr *ContextError
+		assert.True(t, errors.As(err, &contextErr))
+		assert.Equal(t, Position{Line: 1}, contextErr.Position)
+	})
+
+	t.Run("Canceled context should report the position reached", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		parser := NewParser(strings.NewReader(input))
+		for i := 0; i < 10; i++ {
+			_, err := parser.Next()
+			assert.NoError(t, err)
+		}
+		cancel()
+
+		_, err := parser.SegmentsContext(ctx)
+		var contextErr *ContextError
+		assert.True(t, errors.As(err, &contextErr))
+		assert.Equal(t, Position{Offset: 196, Segment: 10, Line: 1}, contextErr.Position)
+	})
+
+	t.Run("Exceeded deadline should stop", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+
+		parser := NewParser(strings.NewReader(input), WithRecovery())
+		_, err := parser.SegmentsContext(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestParser_InterchangesContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	file, err := os.Open("./test/multiple_interchanges.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	parser := NewParser(file)
+	interchanges, err := parser.InterchangesContext(ctx)
+	assert.Nil(t, interchanges)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func BenchmarkParser_Segments(b *testing.B) {
+	inputs := map[string][]byte{}
+	for name, path := range map[string]string{
+		"850_long":  "./test/850_long.txt",
+		"850_tilde": "./test/850_with_tilde_segment_terminator.txt",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs[name] = data
+	}
+	inputs["synthetic_1M_segments"] = syntheticInput(1000000)
+
+	for name, data := range inputs {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := NewParser(bytes.NewReader(data)).Segments(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
@@ -1,13 +1,16 @@
 package hedi
 
 import (
+	"strconv"
 	"strings"
 )
 
 // Segment represents an EDI segment, which consists of an ID and a list of Elements.
+// Position records where a parsed Segment originates in the input.
 type Segment struct {
 	ID       string
 	Elements Elements
+	Position Position
 }
 
 // NewSegment constructs a new Segment with the given ID.
@@ -15,20 +18,27 @@ func NewSegment(id string) *Segment {
 	return &Segment{ID: id}
 }
 
-// String converts the Segment to its EDI string representation using default delimiters.
+// String converts the Segment to its EDI string representation using the DefaultDelimiters5010.
 func (s Segment) String() string {
-	return s.DString(DefaultDelimiters)
+	return s.DString(DefaultDelimiters5010)
 }
 
-// DString converts the Segment to its EDI string representation using the provided delimiters.
-func (s Segment) DString(delimiters Delimiters) string {
+// DString converts the Segment to its EDI string representation using the provided delimiters and WriteOptions.
+// Values are escaped with the Release character, if set, except in the fixed-width ISA segment.
+// Wrapping only applies when writing Segments. It panics as for Element.DString.
+func (s Segment) DString(delimiters Delimiters, opts ...WriteOption) string {
 	var sb strings.Builder
+	config := newWriteConfig(opts)
+
+	if s.ID == "ISA" {
+		delimiters.Release = 0
+	}
 
 	// Append Segment ID
 	sb.WriteString(s.ID)
 
 	// Append each Element's string representation
-	for _, element := range s.Elements {
+	for _, element := range config.elements(s) {
 		sb.WriteString(string(delimiters.Element))
 		sb.WriteString(element.DString(delimiters))
 	}
@@ -41,9 +51,10 @@ func (s Segment) DString(delimiters Delimiters) string {
 
 // GetElement retrieves the Element at the specified index within the Segment.
 // Returns the Element and a boolean indicating whether the Element was found.
+// Elements beyond the end of the Segment are returned as Omitted.
 func (s Segment) GetElement(index int) (Element, bool) {
 	if len(s.Elements) <= index {
-		return Element{}, false
+		return Element{Omitted: true}, false
 	}
 	return s.Elements[index], true
 }
@@ -54,11 +65,25 @@ func (s *Segment) AddElement(element Element) {
 }
 
 // SetElement replaces or appends an Element at the specified index in the Segment.
-// If the index exceeds the current size, the Elements slice is expanded.
+// If the index exceeds the current size, the Elements slice is expanded with Omitted elements.
 func (s *Segment) SetElement(index int, element Element) {
-	if index >= len(s.Elements) {
-		newElements := make([]Element, index+1-len(s.Elements))
-		s.Elements = append(s.Elements, newElements...)
+	for len(s.Elements) <= index {
+		s.Elements = append(s.Elements, Element{Omitted: true})
 	}
 	s.Elements[index] = element
 }
+
+// setTrailer sets the count and control number, in the first and second elements, of a trailer Segment.
+// The control number is copied from the 1-based element of header.
+func (s *Segment) setTrailer(count int, header Segment, element int) {
+	controlNumber, _ := header.GetElement(element - 1)
+	s.SetElement(0, Element{Value: strconv.Itoa(count)})
+	s.SetElement(1, Element{Value: controlNumber.Value})
+}
+
+// withElement returns a copy of the Segment with the 1-based element set to value, leaving the original unchanged.
+func (s Segment) withElement(element int, value string) Segment {
+	s.Elements = append(Elements(nil), s.Elements...)
+	s.SetElement(element-1, Element{Value: value})
+	return s
+}
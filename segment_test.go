@@ -24,6 +24,32 @@ func TestSegment_DString(t *testing.T) {
 	assert.Equal(t, "ISA*00*ZZ~", segment.DString(DefaultDelimiters))
 }
 
+func TestSegment_DString_Release(t *testing.T) {
+	delimiters := Delimiters{Segment: '~', Element: '*', SubElement: '>', Release: '?'}
+
+	t.Run("Delimiters within values are escaped", func(t *testing.T) {
+		segment := NewSegment("N1")
+		segment.AddElement(Element{Value: "ST"})
+		segment.AddElement(Element{Value: "A*B", SubElements: []string{"C>D"}})
+		assert.Equal(t, "N1*ST*A?*B>C?>D~", segment.DString(delimiters))
+	})
+
+	t.Run("ISA values are never escaped", func(t *testing.T) {
+		segment := NewSegment("ISA")
+		segment.AddElement(Element{Value: ">"})
+		assert.Equal(t, "ISA*>~", segment.DString(delimiters))
+	})
+}
+
+func TestSegment_DString_TrimTrailing(t *testing.T) {
+	segment := NewSegment("N1")
+	segment.AddElement(Element{Value: "ST"})
+	segment.AddElement(Element{Value: "9", SubElements: []string{"1", "", ""}})
+	segment.SetElement(4, Element{})
+	assert.Equal(t, "N1*ST*9>1>>***~", segment.DString(DefaultDelimiters))
+	assert.Equal(t, "N1*ST*9>1~", segment.DString(DefaultDelimiters, WithTrimTrailing()))
+}
+
 func TestSegment_GetElement(t *testing.T) {
 	segment := NewSegment("ISA")
 	segment.AddElement(Element{Value: "00"})
@@ -31,8 +57,9 @@ func TestSegment_GetElement(t *testing.T) {
 	assert.True(t, found)
 	assert.Equal(t, "00", element.Value)
 
-	_, found = segment.GetElement(1)
+	element, found = segment.GetElement(1)
 	assert.False(t, found)
+	assert.True(t, element.Omitted)
 }
 
 func TestSegment_AddElement(t *testing.T) {
@@ -47,4 +74,6 @@ func TestSegment_SetElement(t *testing.T) {
 	segment.SetElement(1, Element{Value: "ZZ"})
 	assert.Len(t, segment.Elements, 2)
 	assert.Equal(t, "ZZ", segment.Elements[1].Value)
+	assert.True(t, segment.Elements[0].Omitted)
+	assert.False(t, segment.Elements[1].Omitted)
 }
@@ -10,52 +10,92 @@ import (
 // Segments is a slice of Segment types.
 type Segments []Segment
 
-// String satisfies the fmt.Stringer interface, delegating to DString.
+// String satisfies the fmt.Stringer interface, delegating to DString with the DefaultDelimiters5010.
 func (s Segments) String() string {
-	return s.DString(DefaultDelimiters)
+	return s.DString(DefaultDelimiters5010)
 }
 
-// DString constructs a string representation of Segments using provided delimiters.
-func (s *Segments) DString(delimiters Delimiters) string {
+// DString constructs a string representation of Segments using provided delimiters and WriteOptions.
+// It panics as for Element.DString.
+func (s *Segments) DString(delimiters Delimiters, opts ...WriteOption) string {
+	config := newWriteConfig(opts)
+	if config.wrapWidth > 0 {
+		var sb strings.Builder
+		if _, err := s.DWriteTo(delimiters, &sb, opts...); err != nil {
+			panic(err)
+		}
+		return sb.String()
+	}
+
 	var sb strings.Builder
-	for _, segment := range *s {
-		sb.WriteString(segment.DString(delimiters))
+	for _, segment := range config.segments(*s) {
+		sb.WriteString(segment.DString(delimiters, opts...))
 	}
 	return sb.String()
 }
 
-// WriteTo satisfies the io.WriterTo interface, delegating to DWriteTo.
+// WriteTo satisfies the io.WriterTo interface, delegating to DWriteTo with the DefaultDelimiters5010.
 func (s *Segments) WriteTo(w io.Writer) (int64, error) {
-	return s.DWriteTo(DefaultDelimiters, w)
+	return s.DWriteTo(DefaultDelimiters5010, w)
 }
 
-// DWriteTo writes the Segments to an io.Writer w, formatted with specified delimiters.
-// Returns the number of bytes written and any error encountered.
-func (s *Segments) DWriteTo(d Delimiters, w io.Writer) (int64, error) {
-	var total int64
+// DWriteTo writes the Segments to an io.Writer w, formatted with specified delimiters and WriteOptions.
+// Values are escaped with the Release character, if set, except in the fixed-width ISA segment.
+// Returns the number of bytes written and any error encountered, which wraps ErrNoRepetitionSeparator
+// if an element has repetitions and the delimiters have no Repetition separator.
+func (s *Segments) DWriteTo(delimiters Delimiters, w io.Writer, opts ...WriteOption) (total int64, err error) {
+	config := newWriteConfig(opts)
+
+	if config.wrapWidth > 0 {
+		wrapped := &wrapWriter{writer: w, width: config.wrapWidth, ending: config.wrapEnding}
+		w = wrapped
+		defer func() {
+			if err == nil {
+				err = wrapped.Close()
+			}
+			total = wrapped.written
+		}()
+	}
+
 	bufferedWriter := bufio.NewWriter(w)
 
-	for _, segment := range *s {
+	for _, segment := range config.segments(*s) {
+		d := delimiters
+		if segment.ID == "ISA" {
+			d.Release = 0
+		}
+
 		n, err := bufferedWriter.WriteString(segment.ID)
 		total += int64(n)
 		if err != nil {
 			return total, err
 		}
 
-		for _, element := range segment.Elements {
-			m, err := bufferedWriter.WriteString(fmt.Sprintf("%c%s", d.Element, element.Value))
+		for _, element := range config.elements(segment) {
+			m, err := bufferedWriter.WriteString(fmt.Sprintf("%c%s", d.Element, d.escape(element.Value)))
 			total += int64(m)
 			if err != nil {
 				return total, err
 			}
 
 			for _, sub := range element.SubElements {
-				o, err := bufferedWriter.WriteString(fmt.Sprintf("%c%s", d.SubElement, sub))
+				o, err := bufferedWriter.WriteString(fmt.Sprintf("%c%s", d.SubElement, d.escape(sub)))
 				total += int64(o)
 				if err != nil {
 					return total, err
 				}
 			}
+
+			if len(element.Repetitions) > 0 && d.Repetition == 0 {
+				return total, fmt.Errorf("%w: %s segment", ErrNoRepetitionSeparator, segment.ID)
+			}
+			for _, repetition := range element.Repetitions {
+				q, err := bufferedWriter.WriteString(fmt.Sprintf("%c%s", d.Repetition, repetition.DString(d)))
+				total += int64(q)
+				if err != nil {
+					return total, err
+				}
+			}
 		}
 
 		p, err := bufferedWriter.WriteString(string(d.Segment))
@@ -73,6 +113,63 @@ func (s *Segments) DWriteTo(d Delimiters, w io.Writer) (int64, error) {
 	return total, nil
 }
 
+// Normalize recomputes the envelope trailers of the Segments in place: the SE01 segment counts, GE01 transaction
+// set counts and IEA01 group counts, and the SE02, GE02 and IEA02 control numbers, copied from ST02, GS06 and ISA13.
+// Missing trailers are not added.
+func (s *Segments) Normalize() {
+	segments := *s
+	isa, gs, st := -1, -1, -1
+	groups, sets, count := 0, 0, 0
+
+	for i := range segments {
+		switch segments[i].ID {
+		case "ISA":
+			isa, gs, st, groups = i, -1, -1, 0
+		case "GS":
+			gs, st, sets = i, -1, 0
+			if isa >= 0 {
+				groups++
+			}
+		case "ST":
+			st, count = i, 1
+			if gs >= 0 {
+				sets++
+			}
+		case "SE":
+			if st >= 0 {
+				segments[i].setTrailer(count+1, segments[st], 2)
+			}
+			st = -1
+		case "GE":
+			if gs >= 0 {
+				segments[i].setTrailer(sets, segments[gs], 6)
+			}
+			gs, st = -1, -1
+		case "IEA":
+			if isa >= 0 {
+				segments[i].setTrailer(groups, segments[isa], 13)
+			}
+			isa, gs, st = -1, -1, -1
+		default:
+			count++
+		}
+	}
+}
+
+// normalized returns a normalized copy of the Segments, without modifying the originals.
+func (s Segments) normalized() Segments {
+	normalized := make(Segments, len(s))
+	copy(normalized, s)
+	for i, segment := range normalized {
+		switch segment.ID {
+		case "SE", "GE", "IEA":
+			normalized[i].Elements = append(Elements(nil), segment.Elements...)
+		}
+	}
+	normalized.Normalize()
+	return normalized
+}
+
 // Last returns a pointer to the last segment in the list, or nil if the list is empty.
 // The boolean return value indicates the presence of a last segment.
 func (s *Segments) Last() (*Segment, bool) {
@@ -3,6 +3,7 @@ package hedi
 import (
 	"bytes"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +53,108 @@ func TestSegments_DWriteTo(t *testing.T) {
 	assert.Equal(t, "ISA|00~GS|PO~", buf.String())
 }
 
+func TestSegments_DWriteTo_Repetitions(t *testing.T) {
+	seg := Segments{
+		Segment{ID: "HI", Elements: Elements{{
+			Value:       "ABK",
+			SubElements: []string{"I10"},
+			Repetitions: Elements{{Value: "ABF", SubElements: []string{"I11"}}},
+		}}},
+	}
+	buf := bytes.NewBuffer([]byte{})
+	delimiters := Delimiters{Element: '*', SubElement: ':', Segment: '~', Repetition: '^'}
+
+	n, err := seg.DWriteTo(delimiters, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(19), n)
+	assert.Equal(t, "HI*ABK:I10^ABF:I11~", buf.String())
+
+	t.Run("Repetitions without a repetition separator fail", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		_, err := seg.DWriteTo(DefaultDelimiters, buf)
+		assert.ErrorIs(t, err, ErrNoRepetitionSeparator)
+		assert.NotContains(t, buf.String(), "\x00")
+
+		assert.PanicsWithValue(t, ErrNoRepetitionSeparator, func() { _ = seg.DString(DefaultDelimiters) })
+		assert.Panics(t, func() { _ = seg.DString(DefaultDelimiters, WithWrap(80, LineEndingLF)) })
+	})
+}
+
+func TestSegments_DWriteTo_Release(t *testing.T) {
+	seg := Segments{
+		Segment{ID: "ISA", Elements: Elements{{Value: ">"}}},
+		Segment{ID: "N1", Elements: Elements{{Value: "A*B", SubElements: []string{"C>D"}}}},
+	}
+	buf := bytes.NewBuffer([]byte{})
+	delimiters := Delimiters{Element: '*', SubElement: '>', Segment: '~', Release: '?'}
+
+	_, err := seg.DWriteTo(delimiters, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "ISA*>~N1*A?*B>C?>D~", buf.String())
+}
+
+func TestSegments_DWriteTo_TrimTrailing(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*^*00501*000000000*0*T*>~"
+	input := isa + "N1*ST**9>1>>~REF*ZZ*^A^^~DTM*****~"
+	segments, err := NewParser(strings.NewReader(input)).Segments()
+	assert.NoError(t, err)
+
+	t.Run("Empty elements are written by default", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		_, err := segments.DWriteTo(DefaultDelimiters5010, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, input, buf.String())
+	})
+
+	t.Run("Trailing empty elements, sub-elements and repetitions are trimmed", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		_, err := segments.DWriteTo(DefaultDelimiters5010, buf, WithTrimTrailing())
+		assert.NoError(t, err)
+		assert.Equal(t, isa+"N1*ST**9>1~REF*ZZ*^A~DTM~", buf.String())
+		assert.Equal(t, buf.String(), segments.DString(DefaultDelimiters5010, WithTrimTrailing()))
+	})
+}
+
+func TestSegments_Normalize(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000007*0*T*>~"
+	input := isa + "GS*PO*S*R*20190430*1230*3*X*004010~ST*850*0001~BEG*00~REF*ZZ~SE*9*9999~ST*850*0002~BEG*00~SE~GE*5*1~" +
+		"GS*IN*S*R*20190430*1230*4*X*004010~ST*810*0003~BIG*20190430~SE*3*0003~GE*1*4~IEA*9*000000001~"
+	want := isa + "GS*PO*S*R*20190430*1230*3*X*004010~ST*850*0001~BEG*00~REF*ZZ~SE*4*0001~ST*850*0002~BEG*00~SE*3*0002~GE*2*3~" +
+		"GS*IN*S*R*20190430*1230*4*X*004010~ST*810*0003~BIG*20190430~SE*3*0003~GE*1*4~IEA*2*000000007~"
+
+	t.Run("Trailers are recomputed in place", func(t *testing.T) {
+		segments, err := NewParser(strings.NewReader(input)).Segments()
+		assert.NoError(t, err)
+		assert.NotEmpty(t, segments.Validate())
+
+		segments.Normalize()
+		assert.Equal(t, want, segments.String())
+		assert.Empty(t, segments.Validate())
+	})
+
+	t.Run("Segments outside envelopes are left alone", func(t *testing.T) {
+		segments := Segments{
+			{ID: "SE", Elements: Elements{{Value: "1"}, {Value: "1"}}},
+			{ID: "ST", Elements: Elements{{Value: "850"}, {Value: "0001"}}},
+			{ID: "BEG"},
+		}
+		segments.Normalize()
+		assert.Equal(t, "SE*1*1~ST*850*0001~BEG~", segments.String())
+	})
+
+	t.Run("Writing normalizes a copy", func(t *testing.T) {
+		segments, err := NewParser(strings.NewReader(input)).Segments()
+		assert.NoError(t, err)
+
+		buf := bytes.NewBuffer([]byte{})
+		_, err = segments.DWriteTo(DefaultDelimiters, buf, WithNormalize())
+		assert.NoError(t, err)
+		assert.Equal(t, want, buf.String())
+		assert.Equal(t, want, segments.DString(DefaultDelimiters, WithNormalize()))
+		assert.Equal(t, input, segments.String())
+	})
+}
+
 func TestSegments_Last(t *testing.T) {
 	seg := Segments{
 		Segment{ID: "ISA", Elements: Elements{{Value: "00"}}},
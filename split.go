@@ -0,0 +1,188 @@
+package hedi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoInterchanges is returned when there are no interchanges to merge.
+	ErrNoInterchanges = errors.New("no interchanges")
+	// ErrPartnerMismatch is returned when interchanges to be merged are between different senders or receivers.
+	ErrPartnerMismatch = errors.New("interchanges between different partners")
+	// ErrHeaderMismatch is returned when interchanges to be merged have different ISA12 versions or ISA15 usage indicators.
+	ErrHeaderMismatch = errors.New("interchanges with different versions or usage indicators")
+)
+
+// SplitByTransactionSet splits the Interchange into one interchange per transaction set, in order, each with
+// the ISA and GS headers of the original, and with its trailer counts recalculated. Segments between groups,
+// such as TA1 acknowledgments, are dropped. The original Delimiters are kept.
+// As each interchange must have its own control numbers, ISA13, GS06 and ST02 are drawn from source, for the
+// sender and receiver of ISA06 and ISA08, or else interchanges are numbered on from the original ISA13,
+// and groups and transaction sets from 1.
+// The envelope hierarchy is built from Segments, and it returns an ErrorList if it is incomplete.
+func (i Interchange) SplitByTransactionSet(source ControlNumberSource) ([]Interchange, error) {
+	sources, err := envelopes(i.Segments, i.Delimiters)
+	if err != nil {
+		return nil, err
+	}
+
+	var split []Interchange
+	for _, original := range sources {
+		sender := strings.TrimSpace(elementValue(original.Header, 6))
+		receiver := strings.TrimSpace(elementValue(original.Header, 8))
+		first, _ := strconv.Atoi(strings.TrimSpace(elementValue(original.Header, 13)))
+
+		sequence := 0
+		for _, group := range original.FunctionalGroups {
+			for _, set := range group.TransactionSets {
+				isa13, err := drawControlNumber(source, sender, receiver, InterchangeLevel, (first+sequence-1)%maxControlNumber+1)
+				if err != nil {
+					return nil, err
+				}
+				gs06, err := drawControlNumber(source, sender, receiver, GroupLevel, 1)
+				if err != nil {
+					return nil, err
+				}
+				st02, err := drawControlNumber(source, sender, receiver, TransactionSetLevel, 1)
+				if err != nil {
+					return nil, err
+				}
+				sequence++
+
+				segments := Segments{
+					original.Header.withElement(13, fmt.Sprintf("%0*d", isaFieldWidths[12], isa13)),
+					group.Header.withElement(6, fmt.Sprint(gs06)),
+					set.Header.withElement(2, fmt.Sprintf("%04d", st02)),
+				}
+				segments = append(segments, set.Segments...)
+				segments = append(segments, Segment{ID: "SE"}, Segment{ID: "GE"}, Segment{ID: "IEA"})
+				segments.Normalize()
+
+				interchanges, err := envelopes(segments, i.Delimiters)
+				if err != nil {
+					return nil, err
+				}
+				split = append(split, interchanges...)
+			}
+		}
+	}
+	return split, nil
+}
+
+// MergeInterchanges merges the transaction sets of interchanges between the same sender and receiver into a
+// single interchange, with the Delimiters and ISA header of the first, and fails unless they have the same ISA12
+// version and ISA15 usage indicator. Transaction sets are grouped by their GS01
+// functional identifier code and GS08 version, under the GS header of the first group of each, in order of
+// appearance. As control numbers must be unique within the merged interchange, ISA13, GS06 and ST02 are
+// drawn from source, for the sender and receiver of ISA06 and ISA08, or else the ISA13 of the first interchange
+// is kept and groups and transaction sets are numbered from 1. Trailers are recalculated.
+// The envelope hierarchies are built from Segments, and it returns an ErrorList if one is incomplete.
+func MergeInterchanges(source ControlNumberSource, interchanges ...Interchange) (Interchange, error) {
+	type mergedGroup struct {
+		header Segment
+		sets   []TransactionSet
+	}
+	var first *Interchange
+	var groups []*mergedGroup
+	index := map[[2]string]*mergedGroup{}
+
+	for _, interchange := range interchanges {
+		built, err := envelopes(interchange.Segments, interchange.Delimiters)
+		if err != nil {
+			return Interchange{}, err
+		}
+		for i := range built {
+			if first == nil {
+				first = &built[i]
+			} else if !sameElements(first.Header, built[i].Header, 5, 6, 7, 8) {
+				return Interchange{}, fmt.Errorf("%w: %s", ErrPartnerMismatch, built[i].Header.DString(interchange.Delimiters))
+			} else if !sameElements(first.Header, built[i].Header, 12, 15) {
+				return Interchange{}, fmt.Errorf("%w: %s", ErrHeaderMismatch, built[i].Header.DString(interchange.Delimiters))
+			}
+
+			for _, group := range built[i].FunctionalGroups {
+				key := [2]string{elementValue(group.Header, 1), elementValue(group.Header, 8)}
+				merged, ok := index[key]
+				if !ok {
+					merged = &mergedGroup{header: group.Header}
+					index[key] = merged
+					groups = append(groups, merged)
+				}
+				merged.sets = append(merged.sets, group.TransactionSets...)
+			}
+		}
+	}
+	if first == nil {
+		return Interchange{}, ErrNoInterchanges
+	}
+
+	sender := strings.TrimSpace(elementValue(first.Header, 6))
+	receiver := strings.TrimSpace(elementValue(first.Header, 8))
+
+	header := first.Header
+	if source != nil {
+		n, err := drawControlNumber(source, sender, receiver, InterchangeLevel, 0)
+		if err != nil {
+			return Interchange{}, err
+		}
+		header = header.withElement(13, fmt.Sprintf("%0*d", isaFieldWidths[12], n))
+	}
+	segments := Segments{header}
+
+	for i, group := range groups {
+		n, err := drawControlNumber(source, sender, receiver, GroupLevel, i+1)
+		if err != nil {
+			return Interchange{}, err
+		}
+		segments = append(segments, group.header.withElement(6, fmt.Sprint(n)))
+
+		for j, set := range group.sets {
+			n, err := drawControlNumber(source, sender, receiver, TransactionSetLevel, j+1)
+			if err != nil {
+				return Interchange{}, err
+			}
+			segments = append(segments, set.Header.withElement(2, fmt.Sprintf("%04d", n)))
+			segments = append(segments, set.Segments...)
+			segments = append(segments, Segment{ID: "SE"})
+		}
+		segments = append(segments, Segment{ID: "GE"})
+	}
+	segments = append(segments, Segment{ID: "IEA"})
+	segments.Normalize()
+
+	merged, err := envelopes(segments, first.Delimiters)
+	if err != nil {
+		return Interchange{}, err
+	}
+	return merged[0], nil
+}
+
+// drawControlNumber draws the next control number at level from source, or returns sequence if source is nil.
+func drawControlNumber(source ControlNumberSource, sender, receiver string, level ControlLevel, sequence int) (int, error) {
+	if source == nil {
+		return sequence, nil
+	}
+	return source.Next(sender, receiver, level)
+}
+
+// sameElements reports whether two segments have the same values, ignoring padding, at the given 1-based elements.
+func sameElements(a, b Segment, elements ...int) bool {
+	for _, element := range elements {
+		if strings.TrimSpace(elementValue(a, element)) != strings.TrimSpace(elementValue(b, element)) {
+			return false
+		}
+	}
+	return true
+}
+
+// envelopes builds the envelope hierarchy of segments, returning an ErrorList if it is incomplete.
+func envelopes(segments Segments, delimiters Delimiters) ([]Interchange, error) {
+	builder := &envelopeBuilder{}
+	for _, segment := range segments {
+		builder.add(segment, delimiters)
+	}
+	return builder.result(nil)
+}
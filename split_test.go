@@ -0,0 +1,149 @@
+package hedi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInterchange_SplitByTransactionSet(t *testing.T) {
+	isa := "ISA|00|          |00|          |ZZ|SENDER         |ZZ|RECEIVER       |190430|1230|^|00501|000000005|0|P|:\n"
+	input := isa + "GS|PO|SENDER|RECEIVER|20190430|1230|7|X|005010\n" +
+		"ST|850|0001\nBEG|00|SA|PO1||20190430\nPO1|1|10|EA\nSE|4|0001\n" +
+		"ST|850|0002\nBEG|00|SA|PO2||20190430\nSE|3|0002\n" +
+		"GE|2|7\n" +
+		"GS|IN|SENDER|RECEIVER|20190430|1230|8|X|005010\n" +
+		"ST|810|0003\nBIG|20190430|INV1\nSE|3|0003\n" +
+		"GE|1|8\n" +
+		"IEA|2|000000005\n"
+
+	t.Run("Each transaction set gets its own interchange", func(t *testing.T) {
+		interchanges, err := NewParser(strings.NewReader(input)).Interchanges()
+		assert.NoError(t, err)
+
+		split, err := interchanges[0].SplitByTransactionSet(nil)
+		assert.NoError(t, err)
+		assert.Len(t, split, 3)
+
+		assert.Equal(t, strings.Replace(isa, "000000005", "000000006", 1)+"GS|PO|SENDER|RECEIVER|20190430|1230|1|X|005010\n"+
+			"ST|850|0001\nBEG|00|SA|PO2||20190430\nSE|3|0001\n"+
+			"GE|1|1\n"+
+			"IEA|1|000000006\n", split[1].String())
+		assert.Equal(t, "IN", split[2].FunctionalGroups[0].Header.Elements[0].Value)
+
+		for i, interchange := range split {
+			assert.Equal(t, interchanges[0].Delimiters, interchange.Delimiters)
+			assert.Equal(t, fmt.Sprintf("%09d", 5+i), interchange.Header.Elements[12].Value)
+			assert.Empty(t, interchange.Validate())
+		}
+		assert.Equal(t, input, interchanges[0].String())
+	})
+
+	t.Run("Control numbers are drawn from the source", func(t *testing.T) {
+		interchanges, err := NewParser(strings.NewReader(input)).Interchanges()
+		assert.NoError(t, err)
+
+		source := NewMemoryControlNumbers()
+		_, _ = source.Next("SENDER", "RECEIVER", InterchangeLevel)
+		split, err := interchanges[0].SplitByTransactionSet(source)
+		assert.NoError(t, err)
+
+		for i, interchange := range split {
+			assert.Equal(t, fmt.Sprintf("%09d", i+2), interchange.Header.Elements[12].Value)
+			assert.Equal(t, fmt.Sprint(i+1), interchange.FunctionalGroups[0].Header.Elements[5].Value)
+			assert.Equal(t, fmt.Sprintf("%04d", i+1), interchange.FunctionalGroups[0].TransactionSets[0].Header.Elements[1].Value)
+			assert.Empty(t, interchange.Validate())
+		}
+	})
+
+	t.Run("Incomplete envelopes fail", func(t *testing.T) {
+		interchanges, err := NewParser(strings.NewReader(strings.Replace(input, "SE|3|0002\n", "", 1))).Interchanges()
+		assert.NoError(t, err)
+
+		_, err = interchanges[0].SplitByTransactionSet(nil)
+		var list ErrorList
+		assert.True(t, errors.As(err, &list))
+		assert.ErrorIs(t, list[0], ErrMissingTrailer)
+	})
+}
+
+func TestMergeInterchanges(t *testing.T) {
+	file, err := os.Open("./test/multiple_interchanges.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	interchanges, err := NewParser(file).Interchanges()
+	assert.NoError(t, err)
+
+	// The second interchange of the fixture is from another sender, so its invoice is rebuilt between the same partners
+	order, err := interchanges[0].SplitByTransactionSet(nil)
+	assert.NoError(t, err)
+	sender := Party{ID: "SENDER"}
+	receiver := Party{ID: "RECEIVER"}
+	invoice, err := NewInterchange(sender, receiver, WithVersion("004010"), WithUsageIndicator(UsageTest)).
+		Group("IN").TransactionSet("810", interchanges[1].Segments[3:4]).
+		Build(Delimiters{Segment: '\n', Element: '|', SubElement: ':'})
+	assert.NoError(t, err)
+
+	t.Run("Transaction sets are grouped by functional code", func(t *testing.T) {
+		merged, err := MergeInterchanges(nil, order[0], invoice, order[0])
+		assert.NoError(t, err)
+		assert.Equal(t, interchanges[0].Delimiters, merged.Delimiters)
+		assert.Equal(t, interchanges[0].Segments[0], merged.Header)
+		assert.Empty(t, merged.Validate())
+
+		groups := merged.FunctionalGroups
+		assert.Len(t, groups, 2)
+		assert.Equal(t, "PO", groups[0].Header.Elements[0].Value)
+		assert.Equal(t, "1", groups[0].Header.Elements[5].Value)
+		assert.Len(t, groups[0].TransactionSets, 2)
+		assert.Equal(t, "0002", groups[0].TransactionSets[1].Header.Elements[1].Value)
+		assert.Equal(t, "IN", groups[1].Header.Elements[0].Value)
+		assert.Equal(t, "2", groups[1].Header.Elements[5].Value)
+		assert.Equal(t, "BIG", groups[1].TransactionSets[0].Segments[0].ID)
+
+		assert.Equal(t, "GE*2*1~", groups[0].Trailer.String())
+		assert.Equal(t, "IEA*2*000000001~", merged.Trailer.String())
+
+		// The originals are left unchanged
+		assert.Equal(t, "1", order[0].FunctionalGroups[0].Header.Elements[5].Value)
+		assert.Equal(t, "0001", order[0].FunctionalGroups[0].TransactionSets[0].Header.Elements[1].Value)
+	})
+
+	t.Run("Control numbers are drawn from the source", func(t *testing.T) {
+		source := NewMemoryControlNumbers()
+		_, _ = source.Next("SENDER", "RECEIVER", InterchangeLevel)
+
+		merged, err := MergeInterchanges(source, order[0], order[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "000000002", merged.Header.Elements[12].Value)
+		assert.Equal(t, "000000002", merged.Trailer.Elements[1].Value)
+		assert.Equal(t, "0002", merged.FunctionalGroups[0].TransactionSets[1].Header.Elements[1].Value)
+		assert.Empty(t, merged.Validate())
+	})
+
+	t.Run("Different partners fail", func(t *testing.T) {
+		_, err := MergeInterchanges(nil, interchanges...)
+		assert.ErrorIs(t, err, ErrPartnerMismatch)
+	})
+
+	t.Run("Different versions or usage indicators fail", func(t *testing.T) {
+		for _, opt := range []BuildOption{WithVersion("003040"), WithUsageIndicator(UsageProduction)} {
+			other, err := NewInterchange(sender, receiver, WithVersion("004010"), WithUsageIndicator(UsageTest), opt).
+				Group("IN").TransactionSet("810", interchanges[1].Segments[3:4]).
+				Build(Delimiters{Segment: '\n', Element: '|', SubElement: ':'})
+			assert.NoError(t, err)
+
+			_, err = MergeInterchanges(nil, invoice, other)
+			assert.ErrorIs(t, err, ErrHeaderMismatch)
+		}
+	})
+
+	t.Run("Nothing to merge fails", func(t *testing.T) {
+		_, err := MergeInterchanges(nil)
+		assert.ErrorIs(t, err, ErrNoInterchanges)
+	})
+}
@@ -22,10 +22,61 @@ const (
 
 	// SubElementDelimiter represents the type of token that delimits sub-elements.
 	SubElementDelimiter TokenType = "sub_element_delimiter"
+
+	// RepetitionValue represents the type of token that holds the value of a repeated element.
+	RepetitionValue TokenType = "repetition_value"
+
+	// RepetitionDelimiter represents the type of token that delimits repeated elements.
+	RepetitionDelimiter TokenType = "repetition_delimiter"
 )
 
-// Token structure holding the type and value of a parsed token.
+// Token structure holding the type, value and source position of a parsed token.
 type Token struct {
-	Type  TokenType `json:"type"`
-	Value string    `json:"value"`
+	Type     TokenType `json:"type"`
+	Value    string    `json:"value"`
+	Position Position  `json:"position"`
+}
+
+// RawToken is a Token whose Value refers to the Lexer's buffers rather than to a copy of the input.
+// Its Value is only valid until the next call to the Lexer; use Clone or Token to retain it.
+type RawToken struct {
+	Type     TokenType
+	Value    []byte
+	Position Position
+}
+
+// Clone returns a copy of the RawToken whose Value no longer refers to the Lexer's buffers.
+func (t RawToken) Clone() RawToken {
+	t.Value = append([]byte(nil), t.Value...)
+	return t
+}
+
+// Token returns the RawToken as a Token, copying its Value.
+func (t RawToken) Token() Token {
+	return Token{Type: t.Type, Value: string(t.Value), Position: t.Position}
+}
+
+// Position describes where a Token or Segment originates in the input.
+type Position struct {
+	// Offset is the byte offset from the start of the input.
+	Offset int64 `json:"offset"`
+
+	// Segment is the 1-based ordinal of the segment within the input.
+	Segment int `json:"segment"`
+
+	// Element is the 1-based index of the element within its segment,
+	// or 0 for segment identifiers and terminators.
+	Element int `json:"element"`
+
+	// Line is the 1-based line number, which is most meaningful when segments are terminated by line feeds.
+	Line int `json:"line"`
+}
+
+// from returns the Position, taken relative to the start of a segment, as an absolute Position
+// given the Position of the input preceding that segment.
+func (p Position) from(base Position) Position {
+	p.Offset += base.Offset
+	p.Segment += base.Segment
+	p.Line += base.Line - 1
+	return p
 }
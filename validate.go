@@ -0,0 +1,186 @@
+package hedi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+var (
+	// ErrControlNumberMismatch is returned when a trailer's control number differs from its header's.
+	ErrControlNumberMismatch = errors.New("control number mismatch")
+	// ErrCountMismatch is returned when a trailer's count of segments, transaction sets or groups is wrong.
+	ErrCountMismatch = errors.New("count mismatch")
+	// ErrDuplicateControlNumber is returned when transaction sets within a group share a control number.
+	ErrDuplicateControlNumber = errors.New("duplicate control number")
+)
+
+// Finding describes a problem found in the envelopes of an interchange by Validate.
+// The underlying error is one of ErrControlNumberMismatch, ErrCountMismatch or ErrDuplicateControlNumber,
+// or, when validating Segments, one of the structural errors reported by Parser.Envelopes.
+type Finding struct {
+	Err error
+	// SegmentID and Element identify the element found wrong, such as SE and 1 for the SE01 segment count.
+	SegmentID string
+	Element   int
+	// Got is the value found, and Want the value expected, if known.
+	Got  string
+	Want string
+	// Positions are the positions of the segments involved: the header and trailer of a mismatched
+	// control number, the trailer of a wrong count, or both headers sharing a control number.
+	Positions []Position
+}
+
+// Error returns a description of the Finding including the element and position involved.
+func (f Finding) Error() string {
+	msg := fmt.Sprintf("%v in %s%02d", f.Err, f.SegmentID, f.Element)
+	if f.Got != "" || f.Want != "" {
+		msg += fmt.Sprintf(": got %q, want %q", f.Got, f.Want)
+	}
+	if len(f.Positions) > 0 {
+		last := f.Positions[len(f.Positions)-1]
+		msg += fmt.Sprintf(" at offset %d (segment %d, line %d)", last.Offset, last.Segment, last.Line)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (f Finding) Unwrap() error {
+	return f.Err
+}
+
+// Validate checks the envelopes of the Interchange, with the hierarchy built from its Segments:
+// that the IEA02, GE02 and SE02 control numbers match the ISA13, GS06 and ST02 of their headers,
+// that the SE01 segment counts, GE01 transaction set counts and IEA01 group counts are right,
+// and that ST02 is unique within each group. Envelopes without a trailer are not checked.
+// The Header, FunctionalGroups and Trailer are only checked as they are if the Interchange has no Segments.
+func (i Interchange) Validate() []Finding {
+	if len(i.Segments) > 0 {
+		i = i.withEnvelopes()
+	}
+	return i.validateEnvelopes()
+}
+
+// validateEnvelopes checks the envelope hierarchy of the Interchange as it is.
+func (i Interchange) validateEnvelopes() []Finding {
+	var findings []Finding
+	if i.Trailer != nil {
+		findings = append(findings, matchControlNumber(i.Header, 13, *i.Trailer, 2)...)
+		findings = append(findings, checkCount(*i.Trailer, len(i.FunctionalGroups))...)
+	}
+
+	for _, group := range i.FunctionalGroups {
+		if group.Trailer != nil {
+			findings = append(findings, matchControlNumber(group.Header, 6, *group.Trailer, 2)...)
+			findings = append(findings, checkCount(*group.Trailer, len(group.TransactionSets))...)
+		}
+
+		seen := map[string]Segment{}
+		for _, set := range group.TransactionSets {
+			controlNumber := elementValue(set.Header, 2)
+			if first, ok := seen[controlNumber]; ok {
+				findings = append(findings, Finding{
+					Err:       ErrDuplicateControlNumber,
+					SegmentID: "ST",
+					Element:   2,
+					Got:       controlNumber,
+					Positions: []Position{elementPosition(first, 2), elementPosition(set.Header, 2)},
+				})
+			} else {
+				seen[controlNumber] = set.Header
+			}
+
+			if set.Trailer != nil {
+				findings = append(findings, matchControlNumber(set.Header, 2, *set.Trailer, 2)...)
+				// The count includes the ST and SE segments themselves
+				findings = append(findings, checkCount(*set.Trailer, len(set.Segments)+2)...)
+			}
+		}
+	}
+	return findings
+}
+
+// Validate builds the envelope hierarchy of the Segments and checks it as for Interchange.Validate.
+// Missing trailers, trailers without a header and segments outside their envelope are also reported,
+// with the errors of Parser.Envelopes. Findings are ordered by the position of the last segment involved.
+func (s Segments) Validate() []Finding {
+	builder := &envelopeBuilder{}
+	for _, segment := range s {
+		builder.add(segment, Delimiters{})
+	}
+	interchanges, err := builder.result(nil)
+
+	var findings []Finding
+	var list ErrorList
+	if errors.As(err, &list) {
+		for _, syntaxErr := range list {
+			findings = append(findings, Finding{
+				Err:       syntaxErr.Err,
+				SegmentID: syntaxErr.SegmentID,
+				Positions: []Position{syntaxErr.Position},
+			})
+		}
+	}
+	for _, interchange := range interchanges {
+		findings = append(findings, interchange.validateEnvelopes()...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return lastSegment(findings[i]) < lastSegment(findings[j])
+	})
+	return findings
+}
+
+// matchControlNumber compares the control number of trailer at element t with that of header at element h.
+func matchControlNumber(header Segment, h int, trailer Segment, t int) []Finding {
+	want, got := elementValue(header, h), elementValue(trailer, t)
+	if got == want {
+		return nil
+	}
+	return []Finding{{
+		Err:       ErrControlNumberMismatch,
+		SegmentID: trailer.ID,
+		Element:   t,
+		Got:       got,
+		Want:      want,
+		Positions: []Position{elementPosition(header, h), elementPosition(trailer, t)},
+	}}
+}
+
+// checkCount compares the count held in the first element of trailer with count.
+func checkCount(trailer Segment, count int) []Finding {
+	got := elementValue(trailer, 1)
+	if n, err := strconv.Atoi(got); err == nil && n == count {
+		return nil
+	}
+	return []Finding{{
+		Err:       ErrCountMismatch,
+		SegmentID: trailer.ID,
+		Element:   1,
+		Got:       got,
+		Want:      strconv.Itoa(count),
+		Positions: []Position{elementPosition(trailer, 1)},
+	}}
+}
+
+// elementValue returns the value of the 1-based element of segment, or "" if it is omitted.
+func elementValue(segment Segment, element int) string {
+	e, _ := segment.GetElement(element - 1)
+	return e.Value
+}
+
+// elementPosition returns the position of segment, pointing at the 1-based element.
+func elementPosition(segment Segment, element int) Position {
+	position := segment.Position
+	position.Element = element
+	return position
+}
+
+// lastSegment returns the ordinal of the last segment involved in f.
+func lastSegment(f Finding) int {
+	if len(f.Positions) == 0 {
+		return 0
+	}
+	return f.Positions[len(f.Positions)-1].Segment
+}
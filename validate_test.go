@@ -0,0 +1,124 @@
+package hedi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+// findingIDs returns the underlying error, segment identifier and element of each Finding.
+func findingIDs(findings []Finding) []string {
+	var ids []string
+	for _, finding := range findings {
+		ids = append(ids, finding.Err.Error()+" "+finding.SegmentID+string(rune('0'+finding.Element)))
+	}
+	return ids
+}
+
+func TestInterchange_Validate(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000001*0*T*>~"
+
+	t.Run("Valid envelopes have no findings", func(t *testing.T) {
+		file, err := os.Open("./test/multiple_interchanges.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		interchanges, err := NewParser(file).Envelopes()
+		assert.NoError(t, err)
+		for _, interchange := range interchanges {
+			assert.Empty(t, interchange.Validate())
+		}
+	})
+
+	t.Run("Mismatched control numbers are found", func(t *testing.T) {
+		input := isa + "GS*PO*S*R*20190430*1230*1*X*004010~ST*850*0001~BEG*00~SE*3*0002~GE*1*2~IEA*1*000000009~"
+		interchanges, err := NewParser(strings.NewReader(input)).Envelopes()
+		assert.NoError(t, err)
+
+		findings := interchanges[0].Validate()
+		assert.Equal(t, []string{
+			"control number mismatch IEA2",
+			"control number mismatch GE2",
+			"control number mismatch SE2",
+		}, findingIDs(findings))
+
+		assert.Equal(t, "000000009", findings[0].Got)
+		assert.Equal(t, "000000001", findings[0].Want)
+		assert.Equal(t, []Position{
+			{Offset: 0, Segment: 1, Element: 13, Line: 1},
+			{Offset: 177, Segment: 7, Element: 2, Line: 1},
+		}, findings[0].Positions)
+		assert.ErrorIs(t, findings[2], ErrControlNumberMismatch)
+		assert.Equal(t, `control number mismatch in SE02: got "0002", want "0001" at offset 160 (segment 5, line 1)`, findings[2].Error())
+	})
+
+	t.Run("Wrong counts are found", func(t *testing.T) {
+		input := isa + "GS*PO*S*R*20190430*1230*1*X*004010~ST*850*0001~BEG*00~REF*ZZ~SE*3*0001~GE*2*1~IEA*X*000000001~"
+		interchanges, err := NewParser(strings.NewReader(input)).Envelopes()
+		assert.NoError(t, err)
+
+		findings := interchanges[0].Validate()
+		assert.Equal(t, []string{
+			"count mismatch IEA1",
+			"count mismatch GE1",
+			"count mismatch SE1",
+		}, findingIDs(findings))
+		assert.Equal(t, "X", findings[0].Got)
+		assert.Equal(t, "1", findings[0].Want)
+		assert.Equal(t, "4", findings[2].Want)
+	})
+
+	t.Run("Duplicate transaction set control numbers are found", func(t *testing.T) {
+		input := isa + "GS*PO*S*R*20190430*1230*1*X*004010~ST*850*0001~SE*2*0001~ST*850*0001~SE*2*0001~GE*2*1~" +
+			"GS*IN*S*R*20190430*1230*2*X*004010~ST*810*0001~SE*2*0001~GE*1*2~IEA*2*000000001~"
+		interchanges, err := NewParser(strings.NewReader(input)).Envelopes()
+		assert.NoError(t, err)
+
+		findings := interchanges[0].Validate()
+		assert.Equal(t, []string{"duplicate control number ST2"}, findingIDs(findings))
+		assert.Equal(t, 3, findings[0].Positions[0].Segment)
+		assert.Equal(t, 5, findings[0].Positions[1].Segment)
+	})
+
+	t.Run("Interchanges read without Envelopes are checked", func(t *testing.T) {
+		input := isa + "GS*PO*S*R*20190430*1230*1*X*004010~ST*850*0001~BEG*00~SE*2*0002~GE*2*2~IEA*2*000000009~"
+		interchanges, err := NewParser(strings.NewReader(input)).Interchanges()
+		assert.NoError(t, err)
+
+		want := []string{
+			"control number mismatch IEA2",
+			"count mismatch IEA1",
+			"control number mismatch GE2",
+			"count mismatch GE1",
+			"control number mismatch SE2",
+			"count mismatch SE1",
+		}
+		assert.Equal(t, want, findingIDs(interchanges[0].Validate()))
+
+		// The hierarchy is rebuilt from Segments, which is what is written
+		unbuilt := Interchange{Delimiters: interchanges[0].Delimiters, Segments: interchanges[0].Segments}
+		assert.Equal(t, want, findingIDs(unbuilt.Validate()))
+		assert.Len(t, unbuilt.Segments.Validate(), 6)
+	})
+}
+
+func TestSegments_Validate(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000001*0*T*>~"
+	input := isa + "GS*PO*S*R*20190430*1230*1*X*004010~ST*850*0001~BEG*00~SE*2*0002~ST*850*0003~BEG*00~GE*2*1~REF*ZZ~IEA*1*000000001~"
+	segments, err := NewParser(strings.NewReader(input)).Segments()
+	assert.NoError(t, err)
+
+	findings := segments.Validate()
+	assert.Equal(t, []string{
+		"control number mismatch SE2",
+		"count mismatch SE1",
+		"missing trailer ST0",
+		"unexpected segment REF0",
+	}, findingIDs(findings))
+	assert.Equal(t, 6, findings[2].Positions[0].Segment)
+
+	segments, err = NewParser(strings.NewReader(strings.Replace(input, "ST*850*0003~BEG*00~GE*2*1~REF*ZZ~", "GE*1*1~", 1))).Segments()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"control number mismatch SE2", "count mismatch SE1"}, findingIDs(segments.Validate()))
+}
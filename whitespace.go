@@ -0,0 +1,69 @@
+package hedi
+
+import (
+	"bytes"
+)
+
+// WhitespacePolicy determines how a Lexer treats whitespace surrounding segments.
+type WhitespacePolicy int
+
+const (
+	// PreserveWhitespace keeps whitespace between segments as part of the following segment.
+	// Only line breaks between interchanges are discarded.
+	PreserveWhitespace WhitespacePolicy = iota
+
+	// TrimWhitespace strips a leading UTF-8 byte order mark and discards carriage returns,
+	// line feeds and spaces between segments, unless they are the segment terminator.
+	// Blank lines are ignored when segments are terminated by line breaks.
+	TrimWhitespace
+)
+
+// LineEnding represents the line break style separating segments in the input.
+type LineEnding string
+
+// Enumerated LineEndings detected by the Lexer.
+const (
+	// LineEndingNone indicates segments are not separated by line breaks.
+	LineEndingNone LineEnding = ""
+
+	// LineEndingLF indicates segments are separated by line feeds.
+	LineEndingLF LineEnding = "\n"
+
+	// LineEndingCRLF indicates segments are separated by carriage return and line feed pairs.
+	LineEndingCRLF LineEnding = "\r\n"
+
+	// LineEndingCR indicates segments are separated by carriage returns.
+	LineEndingCR LineEnding = "\r"
+)
+
+// byteOrderMark is the UTF-8 encoding of the Unicode byte order mark.
+const byteOrderMark = "\xEF\xBB\xBF"
+
+// detectLineEnding determines the LineEnding from a segment terminator and the input following it.
+func detectLineEnding(terminator rune, following []byte) LineEnding {
+	switch {
+	case terminator == '\n':
+		return LineEndingLF
+	case terminator == '\r' && len(following) > 0 && following[0] == '\n':
+		return LineEndingCRLF
+	case terminator == '\r':
+		return LineEndingCR
+	case len(following) > 1 && following[0] == '\r' && following[1] == '\n':
+		return LineEndingCRLF
+	case len(following) > 0 && following[0] == '\n':
+		return LineEndingLF
+	case len(following) > 0 && following[0] == '\r':
+		return LineEndingCR
+	}
+	return LineEndingNone
+}
+
+// trimLineBreaks returns the segment identifier id without any line breaks preserved before it.
+func trimLineBreaks(id []byte) []byte {
+	return bytes.TrimLeft(id, "\r\n")
+}
+
+// isLineBreak reports whether r is a carriage return or line feed.
+func isLineBreak(r rune) bool {
+	return r == '\r' || r == '\n'
+}
@@ -0,0 +1,77 @@
+package hedi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDetectLineEnding(t *testing.T) {
+	tests := []struct {
+		name       string
+		terminator rune
+		following  string
+		want       LineEnding
+	}{
+		{name: "Line feed terminator", terminator: '\n', following: "GS", want: LineEndingLF},
+		{name: "Carriage return terminator followed by line feed", terminator: '\r', following: "\nG", want: LineEndingCRLF},
+		{name: "Carriage return terminator", terminator: '\r', following: "GS", want: LineEndingCR},
+		{name: "Tilde followed by CRLF", terminator: '~', following: "\r\n", want: LineEndingCRLF},
+		{name: "Tilde followed by line feed", terminator: '~', following: "\nG", want: LineEndingLF},
+		{name: "Tilde followed by carriage return", terminator: '~', following: "\rG", want: LineEndingCR},
+		{name: "Tilde followed by segment", terminator: '~', following: "GS", want: LineEndingNone},
+		{name: "Tilde at end of input", terminator: '~', following: "", want: LineEndingNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectLineEnding(tt.terminator, []byte(tt.following)))
+		})
+	}
+}
+
+func TestLexer_Whitespace(t *testing.T) {
+	t.Run("Trim strips BOM, CRLF and trailing blank lines", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_bom_and_crlf.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parser := NewParser(file, WithWhitespace(TrimWhitespace))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 37)
+		assert.Equal(t, "GS", segments[1].ID)
+		assert.Equal(t, Position{Offset: 111, Segment: 2, Line: 2}, segments[1].Position)
+		assert.Equal(t, "IEA", segments[36].ID)
+		assert.Equal(t, LineEndingCRLF, parser.LineEnding())
+	})
+
+	t.Run("Trim ignores spaces and blank lines between segments", func(t *testing.T) {
+		input := "\n ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>\n\n  GS*PO\n\nST*850\n\n"
+		parser := NewParser(strings.NewReader(input), WithWhitespace(TrimWhitespace))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 3)
+		assert.Equal(t, "GS", segments[1].ID)
+		assert.Equal(t, "ST", segments[2].ID)
+		assert.Equal(t, 6, segments[2].Position.Line)
+		assert.Equal(t, LineEndingLF, parser.LineEnding())
+	})
+
+	t.Run("Preserve keeps whitespace in segment identifiers", func(t *testing.T) {
+		input := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~\r\nGS*PO~"
+		parser := NewParser(strings.NewReader(input))
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 2)
+		assert.Equal(t, "\r\nGS", segments[1].ID)
+		assert.Equal(t, LineEndingCRLF, parser.LineEnding())
+	})
+
+	t.Run("Trim on empty input reports invalid ISA", func(t *testing.T) {
+		parser := NewParser(strings.NewReader(byteOrderMark+"\r\n"), WithWhitespace(TrimWhitespace))
+		_, err := parser.Segments()
+		assert.ErrorIs(t, err, ErrInvalidISALength)
+	})
+}
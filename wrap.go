@@ -0,0 +1,126 @@
+package hedi
+
+import (
+	"bytes"
+	"io"
+)
+
+// wrapWidth determines whether the start of an input is hard-wrapped at a fixed line width,
+// regardless of segment boundaries, and returns that width. It returns 0 if the input is not wrapped.
+func wrapWidth(start []byte) int {
+	start = bytes.TrimPrefix(start, []byte(byteOrderMark))
+	start = bytes.TrimLeft(start, "\r\n ")
+	if !bytes.HasPrefix(start, []byte("ISA")) {
+		return 0
+	}
+
+	lines := bytes.Split(start, []byte("\n"))
+	for i := range lines {
+		lines[i] = bytes.TrimSuffix(lines[i], []byte("\r"))
+	}
+	width := len(lines[0])
+
+	// A line break within the ISA segment can only be the result of wrapping
+	if len(lines) > 1 && width < isaLength-1 {
+		return width
+	}
+
+	// Otherwise the ISA segment identifies the terminator, which must end every line unless wrapped
+	first := []rune(string(lines[0]))
+	if len(first) < isaLength {
+		return 0
+	}
+	terminator := first[isaLength-1]
+	if isLineBreak(terminator) {
+		return 0
+	}
+
+	wrapped := false
+	complete := lines[:len(lines)-1] // The last line may be incomplete
+	for i, line := range complete {
+		if len(line) != width && i < len(complete)-1 {
+			return 0
+		}
+		if !bytes.HasSuffix(line, []byte(string(terminator))) {
+			wrapped = true
+		}
+	}
+	if !wrapped {
+		return 0
+	}
+	return width
+}
+
+// unwrapReader is an io.Reader that removes all carriage returns and line feeds from the underlying reader.
+type unwrapReader struct {
+	reader io.Reader
+}
+
+// Read reads from the underlying reader, discarding carriage returns and line feeds.
+func (u *unwrapReader) Read(p []byte) (int, error) {
+	for {
+		n, err := u.reader.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// wrapWriter is an io.Writer that inserts a line ending after every width bytes written.
+type wrapWriter struct {
+	writer  io.Writer
+	width   int
+	ending  LineEnding
+	column  int
+	written int64
+}
+
+// Write writes p to the underlying writer, breaking it into lines of the configured width.
+// It returns the number of bytes of p written, excluding inserted line endings.
+func (w *wrapWriter) Write(p []byte) (int, error) {
+	consumed := 0
+	for len(p) > 0 {
+		chunk := p
+		if remaining := w.width - w.column; len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := w.writer.Write(chunk)
+		consumed += n
+		w.column += n
+		w.written += int64(n)
+		if err != nil {
+			return consumed, err
+		}
+		p = p[n:]
+
+		if w.column == w.width {
+			if err := w.breakLine(); err != nil {
+				return consumed, err
+			}
+		}
+	}
+	return consumed, nil
+}
+
+// Close terminates the final line, if it is incomplete.
+func (w *wrapWriter) Close() error {
+	if w.column == 0 {
+		return nil
+	}
+	return w.breakLine()
+}
+
+// breakLine writes the line ending and starts a new line.
+func (w *wrapWriter) breakLine() error {
+	n, err := io.WriteString(w.writer, string(w.ending))
+	w.written += int64(n)
+	w.column = 0
+	return err
+}
@@ -0,0 +1,114 @@
+package hedi
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWrapWidth(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *190430*1230*U*00401*000000000*0*T*>~"
+	body := "GS*PO*SENDER*RECEIVER*20190430*1230*1*X*004010~ST*850*0001~SE*2*0001~GE*1*1~IEA*1*000000000~"
+	wrap := func(s string, width int, ending string) string {
+		var sb strings.Builder
+		for len(s) > width {
+			sb.WriteString(s[:width] + ending)
+			s = s[width:]
+		}
+		sb.WriteString(s + ending)
+		return sb.String()
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{name: "Wrapped at 80 within the ISA", input: wrap(isa+body, 80, "\n"), want: 80},
+		{name: "Wrapped at 80 with CRLF", input: wrap(isa+body, 80, "\r\n"), want: 80},
+		{name: "Wrapped at 128 after the ISA", input: wrap(isa+body+body, 128, "\n"), want: 128},
+		{name: "Wrapped after a byte order mark", input: byteOrderMark + wrap(isa+body, 80, "\n"), want: 80},
+		{name: "Single line", input: isa + body, want: 0},
+		{name: "One segment per line", input: strings.ReplaceAll(isa+body, "~", "~\n"), want: 0},
+		{name: "Line feed terminator", input: strings.ReplaceAll(isa+body, "~", "\n"), want: 0},
+		{name: "CRLF terminator", input: strings.ReplaceAll(isa+body, "~", "\r\n"), want: 0},
+		{name: "Not an interchange", input: wrap(body, 20, "\n"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, wrapWidth([]byte(tt.input)))
+		})
+	}
+}
+
+func TestUnwrapReader(t *testing.T) {
+	reader := &unwrapReader{reader: strings.NewReader("\r\nISA*0\n0*\r\n~\n")}
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "ISA*00*~", string(data))
+}
+
+func TestWrapWriter(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	writer := &wrapWriter{writer: buf, width: 4, ending: LineEndingCRLF}
+
+	n, err := writer.Write([]byte("ISA*0"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	_, err = writer.Write([]byte("0*~"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	assert.Equal(t, "ISA*\r\n00*~\r\n", buf.String())
+	assert.Equal(t, int64(12), writer.written)
+}
+
+func TestParser_Unwrap(t *testing.T) {
+	t.Run("Wrapped input is unwrapped", func(t *testing.T) {
+		file, err := os.Open("./test/850_wrapped_at_80.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parser := NewParser(file, WithUnwrap())
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 37)
+		assert.Equal(t, 80, parser.WrapWidth())
+		assert.Equal(t, '~', parser.Delimiters().Segment)
+		assert.Equal(t, "IEA", segments[36].ID)
+	})
+
+	t.Run("Unwrapped input is left as is", func(t *testing.T) {
+		file, err := os.Open("./test/850_with_new_line_segment_terminator.txt")
+		assert.NoError(t, err)
+		defer file.Close()
+
+		parser := NewParser(file, WithUnwrap())
+		segments, err := parser.Segments()
+		assert.NoError(t, err)
+		assert.Len(t, segments, 37)
+		assert.Equal(t, 0, parser.WrapWidth())
+	})
+}
+
+func TestSegments_DWriteTo_Wrap(t *testing.T) {
+	file, err := os.Open("./test/850_with_tilde_segment_terminator.txt")
+	assert.NoError(t, err)
+	defer file.Close()
+	parser := NewParser(file)
+	segments, err := parser.Segments()
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile("./test/850_wrapped_at_80.txt")
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer([]byte{})
+	n, err := segments.DWriteTo(parser.Delimiters(), buf, WithWrap(80, LineEndingLF))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(expected)), n)
+	assert.Equal(t, string(expected), buf.String())
+}